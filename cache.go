@@ -0,0 +1,171 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+	"time"
+
+	"github.com/gmlewis/irmf-editor/irmf"
+)
+
+const (
+	includeCacheTTL      = 7 * 24 * time.Hour
+	includeCacheMaxBytes = 4 << 20 // Browsers typically allow 5MB of localStorage.
+)
+
+// curlCache holds everything fetched (or loaded from includeCache) during
+// this session. includeCache persists it across sessions.
+var (
+	curlCache    = map[string][]byte{}
+	includeCache = newIncludeCache()
+)
+
+// localStorageStore implements irmf.CacheStore with the browser's localStorage.
+type localStorageStore struct {
+	storage js.Value
+}
+
+func (s localStorageStore) Get(key string) (string, bool) {
+	v := s.storage.Call("getItem", key)
+	if v.Type() == js.TypeNull || v.Type() == js.TypeUndefined {
+		return "", false
+	}
+	return v.String(), true
+}
+
+func (s localStorageStore) Set(key, value string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("localStorage: %v", r) // e.g. QuotaExceededError
+		}
+	}()
+	s.storage.Call("setItem", key, value)
+	return nil
+}
+
+func (s localStorageStore) Delete(key string) {
+	s.storage.Call("removeItem", key)
+}
+
+func (s localStorageStore) Keys() []string {
+	var result []string
+	for i, n := 0, s.storage.Get("length").Int(); i < n; i++ {
+		result = append(result, s.storage.Call("key", i).String())
+	}
+	return result
+}
+
+// newIncludeCache returns an include cache backed by browserStore.
+func newIncludeCache() *irmf.IncludeCache {
+	return irmf.NewIncludeCache(browserStore(), includeCacheTTL, includeCacheMaxBytes)
+}
+
+// browserStore returns localStorage, or memory if localStorage is not
+// available (e.g. it is disabled).
+func browserStore() (store irmf.CacheStore) {
+	store = irmf.NewMemoryCacheStore()
+	func() {
+		defer func() { recover() }() // Accessing localStorage may throw a SecurityError.
+		if ls := js.Global().Get("localStorage"); ls.Type() == js.TypeObject {
+			ls.Get("length")
+			store = localStorageStore{storage: ls}
+		}
+	}()
+	return store
+}
+
+// cachedInclude returns the cached content of url. Stale (expired)
+// content is only returned if allowStale is true.
+func cachedInclude(url string, allowStale bool) ([]byte, bool) {
+	if buf, ok := curlCache[url]; ok {
+		return buf, true
+	}
+	if isLocalFile(url) {
+		return nil, false
+	}
+	buf, ok := includeCache.Get(url)
+	if !ok && allowStale {
+		buf, _, ok = includeCache.LookupStale(url)
+	}
+	if ok {
+		curlCache[url] = buf
+	}
+	return buf, ok
+}
+
+// storeInclude caches the freshly-fetched content of url.
+func storeInclude(url string, buf []byte, etag string) {
+	curlCache[url] = buf
+	if isLocalFile(url) {
+		return
+	}
+	if err := includeCache.Put(url, buf, etag); err != nil {
+		logf("Unable to save %v to the include cache: %v", url, err)
+	}
+}
+
+// cachedETag returns the ETag of the cached copy of url, if any, for
+// revalidating it once it has expired.
+func cachedETag(url string) string {
+	if isLocalFile(url) {
+		return ""
+	}
+	if _, e, ok := includeCache.LookupStale(url); ok {
+		return e.ETag
+	}
+	return ""
+}
+
+// refreshInclude returns the expired cached copy of url after the server
+// reported that it is still current, marking it as freshly fetched.
+func refreshInclude(url string) ([]byte, bool) {
+	buf, _, ok := includeCache.LookupStale(url)
+	if !ok {
+		return nil, false
+	}
+	if err := includeCache.Refresh(url); err != nil {
+		logf("Unable to refresh %v in the include cache: %v", url, err)
+	}
+	curlCache[url] = buf
+	return buf, true
+}
+
+// evictInclude removes url from the include cache (and forgets any
+// failure to fetch it), so that it is fetched again.
+func evictInclude(url string) {
+	delete(curlCache, url)
+	delete(fetchFailures, url)
+	includeCache.Delete(url)
+}
+
+func listIncludeCacheCallback(this js.Value, args []js.Value) interface{} {
+	entries := includeCache.Entries()
+	var total int
+	for _, e := range entries {
+		total += e.Size
+	}
+	logf("Include cache: %v files, %v of %v bytes, entries expire after %v:", len(entries), total, includeCacheMaxBytes, includeCacheTTL)
+	now := time.Now()
+	for _, e := range entries {
+		status := ""
+		if now.Sub(e.FetchedAt) > includeCacheTTL {
+			status = " (expired)"
+		}
+		etag := ""
+		if e.ETag != "" {
+			etag = ", ETag " + e.ETag
+		}
+		logf("%v: %v bytes, fetched %v%v%v", e.URL, e.Size, e.FetchedAt.Local().Format(time.RFC1123), etag, status)
+	}
+	return nil
+}
+
+func clearIncludeCacheCallback(this js.Value, args []js.Value) interface{} {
+	n := len(includeCache.Entries())
+	includeCache.Clear()
+	curlCache = map[string][]byte{}
+	logf("Cleared %v files from the include cache", n)
+	return nil
+}
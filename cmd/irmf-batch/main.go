@@ -0,0 +1,300 @@
+// irmf-batch validates (and optionally rewrites) all the IRMF shader files
+// within directory trees and reports the stats of their headers.
+//
+// Usage:
+//
+//	irmf-batch [-json] [-normalize] [-inline] [-encode encoding] [-w] [-settings settings.json] [-lygia dir] file.irmf|dir...
+//
+// Directories are searched for .irmf files. For each file, the report lists
+// its IRMF version, language, units, materials, bounding box, encoding, and
+// number of (live, direct) includes, or why it is invalid. The report is a
+// table, or JSON with -json.
+//
+// The files can also be rewritten: -normalize formats their JSON headers
+// like the irmf-editor, -inline inlines their includes (see irmf-inline),
+// and -encode re-encodes their shader bodies ("none" decodes them). Files
+// that would change are marked in the report, and are only written back
+// with -w. The optional settings file lists include hosts and trusted
+// hosts (see irmf.LoadIncludeSettings).
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gmlewis/irmf-editor/irmf"
+)
+
+var (
+	asJSON    = flag.Bool("json", false, "Report in JSON instead of a table")
+	normalize = flag.Bool("normalize", false, "Format the JSON headers like the irmf-editor")
+	inline    = flag.Bool("inline", false, "Inline all #include files")
+	encode    = flag.String("encode", "", fmt.Sprintf("Re-encode the shader bodies (%v, or none to decode them)", strings.Join(irmf.Encodings(), ", ")))
+	write     = flag.Bool("w", false, "Write the rewritten files back instead of only reporting them")
+	lygia     = flag.String("lygia", "", "Directory of a LYGIA mirror written by irmf-lygia")
+	settings  = flag.String("settings", "", "JSON file of include hosts and trusted hosts")
+)
+
+// report describes one IRMF file.
+type report struct {
+	File string `json:"file"`
+	// Errors are why the file is invalid (or could not be rewritten), if
+	// it is, starting with their line numbers when known.
+	Errors      []string  `json:"errors,omitempty"`
+	IRMFVersion string    `json:"irmf,omitempty"`
+	Language    string    `json:"language,omitempty"`
+	Units       string    `json:"units,omitempty"`
+	Materials   []string  `json:"materials,omitempty"`
+	Min         []float64 `json:"min,omitempty"`
+	Max         []float64 `json:"max,omitempty"`
+	Encoding    string    `json:"encoding,omitempty"`
+	Includes    int       `json:"includes"`
+	// Changed means that the rewritten file differs from the original.
+	Changed bool `json:"changed,omitempty"`
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: irmf-batch [-json] [-normalize] [-inline] [-encode encoding] [-w] [-settings settings.json] [-lygia dir] file.irmf|dir...\n\nValidates and reports the stats of IRMF files.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *encode != "" && *encode != "none" && !slices.Contains(irmf.Encodings(), *encode) {
+		log.Fatalf("unsupported encoding %q; use one of: %v, or none", *encode, strings.Join(irmf.Encodings(), ", "))
+	}
+
+	var fetcher irmf.Fetcher = irmf.HTTPFetcher{}
+	if *lygia != "" {
+		mirrorURL, err := irmf.FileURL(*lygia)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fetcher = irmf.LygiaMirror(mirrorURL, fetcher)
+	}
+	var trusted *irmf.IncludeSettings
+	if *settings != "" {
+		s, err := irmf.LoadIncludeSettings(*settings)
+		if err != nil {
+			log.Fatal(err)
+		}
+		trusted = s
+	}
+
+	filenames, err := irmf.FindFiles(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	var reports []*report
+	var failed bool
+	for _, filename := range filenames {
+		r := process(filename, fetcher, trusted)
+		failed = failed || len(r.Errors) > 0
+		reports = append(reports, r)
+	}
+
+	if *asJSON {
+		buf, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s\n", buf)
+	} else {
+		printTable(reports)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// process validates, reports, and (if requested) rewrites filename,
+// fetching its includes with fetcher and the trusted include settings.
+func process(filename string, fetcher irmf.Fetcher, trusted *irmf.IncludeSettings) *report {
+	r := &report{File: filename}
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		r.Errors = errorLines(err, 0)
+		return r
+	}
+	baseURL, err := irmf.FileURL(filename)
+	if err != nil {
+		r.Errors = errorLines(err, 0)
+		return r
+	}
+
+	encoding := headerEncoding(src)
+	jsonBlob, shaderSrc, err := irmf.Parse(src)
+	if err != nil {
+		r.Errors = errorLines(err, 0)
+		return r
+	}
+	r.IRMFVersion = jsonBlob.IRMFVersion
+	r.Language = jsonBlob.Language
+	r.Units = jsonBlob.Units
+	r.Materials = jsonBlob.Materials
+	r.Min = jsonBlob.Min
+	r.Max = jsonBlob.Max
+	r.Encoding = encoding
+	r.Includes = countIncludes(jsonBlob, shaderSrc, baseURL, trusted)
+
+	if !*normalize && !*inline && *encode == "" {
+		return r
+	}
+	if *inline {
+		// Include errors are reported on the lines of the file, unless its
+		// shader body is encoded.
+		var headerLines int
+		if _, body, ok := irmf.SplitFile(src); ok && encoding == "" {
+			headerLines = bytes.Count(src[:len(src)-len(body)], []byte("\n"))
+		}
+		if shaderSrc, err = jsonBlob.InlineIncludes(shaderSrc, baseURL, fetcher, trusted); err != nil {
+			r.Errors = errorLines(err, headerLines)
+			return r
+		}
+	}
+	switch *encode {
+	case "":
+	case "none":
+		encoding = ""
+	default:
+		encoding = *encode
+	}
+	var out []byte
+	if encoding == "" {
+		s, err := jsonBlob.Format(shaderSrc)
+		if err != nil {
+			r.Errors = errorLines(err, 0)
+			return r
+		}
+		out = []byte(s)
+	} else if out, err = jsonBlob.Encode(shaderSrc, encoding); err != nil {
+		r.Errors = errorLines(err, 0)
+		return r
+	}
+
+	r.Changed = !bytes.Equal(out, src)
+	if r.Changed && *write {
+		if err := os.WriteFile(filename, out, 0644); err != nil {
+			r.Errors = errorLines(err, 0)
+		}
+	}
+	return r
+}
+
+// headerEncoding returns the "encoding" of the header of src (which
+// irmf.Parse removes after decoding the shader body), if any.
+func headerEncoding(src []byte) string {
+	header, _, ok := irmf.SplitFile(src)
+	if !ok {
+		return ""
+	}
+	jsonBlob, err := irmf.ParseJSON(header)
+	if err != nil || jsonBlob.Encoding == nil {
+		return ""
+	}
+	return *jsonBlob.Encoding
+}
+
+// countIncludes returns the number of distinct files included by the live
+// "#include" lines of shaderSrc, without fetching them.
+func countIncludes(jsonBlob *irmf.IRMF, shaderSrc, baseURL string, trusted *irmf.IncludeSettings) int {
+	urls := map[string]bool{}
+	fetcher := jsonBlob.IncludeFetcher(irmf.FetchFunc(func(url string) ([]byte, error) {
+		urls[url] = true
+		return nil, nil
+	}), baseURL, trusted)
+	opts := irmf.IncludeOptions{BaseURL: baseURL, Language: jsonBlob.Language}
+	irmf.ExpandIncludes(shaderSrc, opts, fetcher) // Unresolvable includes are reported when inlining.
+	return len(urls)
+}
+
+// errorLines formats the problems of err with their line numbers, if any.
+// The line numbers of include errors are offset by includeOffset.
+func errorLines(err error, includeOffset int) []string {
+	var includeErrs irmf.IncludeErrors
+	var lineErr *irmf.LineError
+	switch {
+	case errors.As(err, &includeErrs):
+		var result []string
+		for _, e := range includeErrs {
+			result = append(result, lineText(&irmf.LineError{Line: e.Line + includeOffset, Err: e.Err}))
+		}
+		return result
+	case errors.As(err, &lineErr):
+		return []string{lineText(lineErr)}
+	}
+	return []string{err.Error()}
+}
+
+// lineText formats err with its line number, if known.
+func lineText(err *irmf.LineError) string {
+	if err.Line > 0 {
+		return fmt.Sprintf("line %v: %v", err.Line, err)
+	}
+	return err.Error()
+}
+
+func printTable(reports []*report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSTATUS\tIRMF\tLANGUAGE\tUNITS\tMATERIALS\tMIN\tMAX\tENCODING\tINCLUDES")
+	var invalid, changed int
+	for _, r := range reports {
+		status := "ok"
+		switch {
+		case len(r.Errors) > 0:
+			status = "invalid"
+			invalid++
+		case r.Changed && *write:
+			status = "rewritten"
+			changed++
+		case r.Changed:
+			status = "would change"
+			changed++
+		}
+		if r.IRMFVersion == "" {
+			fmt.Fprintf(w, "%v\t%v\t\t\t\t\t\t\t\t\n", r.File, status) // Unable to parse.
+			continue
+		}
+		encoding := r.Encoding
+		if encoding == "" {
+			encoding = "-"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", r.File, status, r.IRMFVersion, r.Language, r.Units,
+			strings.Join(r.Materials, ","), vector(r.Min), vector(r.Max), encoding, r.Includes)
+	}
+	w.Flush()
+
+	for _, r := range reports {
+		for _, e := range r.Errors {
+			fmt.Printf("%v: %v\n", r.File, e)
+		}
+	}
+	verb := "would change"
+	if *write {
+		verb = "rewritten"
+	}
+	fmt.Printf("%v files, %v invalid, %v %v\n", len(reports), invalid, changed, verb)
+}
+
+// vector formats a min or max corner.
+func vector(v []float64) string {
+	if len(v) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, f := range v {
+		parts = append(parts, fmt.Sprint(f))
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
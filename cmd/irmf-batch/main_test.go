@@ -0,0 +1,251 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gmlewis/irmf-editor/irmf"
+)
+
+const testHeader = `/*{
+  irmf: "1.0",
+  language: "glsl",
+  materials: ["PLA"],
+  max: [1,1,1],
+  min: [0,0,0],
+  units: "mm",
+}*/
+`
+
+const testShader = `#include "lib/a.glsl"
+
+void mainModel4(out vec4 materials, in vec3 xyz) {
+  materials[0] = a(xyz);
+}
+`
+
+const testLib = "float a(vec3 xyz) { return 1.0; }\n"
+
+func TestProcess(t *testing.T) {
+	jsonBlob, shaderSrc, err := irmf.Parse([]byte(testHeader + testShader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	normalized, err := jsonBlob.Format(shaderSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := jsonBlob.Encode(shaderSrc, "gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		src       string
+		normalize bool
+		inline    bool
+		encode    string
+		write     bool
+		// want is the file after processing; "" means unchanged.
+		want       string
+		wantReport report
+	}{
+		{
+			name:       "report only",
+			src:        testHeader + testShader,
+			wantReport: report{Includes: 1},
+		},
+		{
+			name:       "normalize",
+			src:        testHeader + testShader,
+			normalize:  true,
+			wantReport: report{Includes: 1, Changed: true},
+		},
+		{
+			name:       "normalize and write",
+			src:        testHeader + testShader,
+			normalize:  true,
+			write:      true,
+			want:       normalized,
+			wantReport: report{Includes: 1, Changed: true},
+		},
+		{
+			name:       "normalize a normalized file",
+			src:        normalized,
+			normalize:  true,
+			write:      true,
+			wantReport: report{Includes: 1},
+		},
+		{
+			name:       "encode",
+			src:        testHeader + testShader,
+			encode:     "gzip",
+			wantReport: report{Includes: 1, Changed: true},
+		},
+		{
+			name:       "encode and write",
+			src:        testHeader + testShader,
+			encode:     "gzip",
+			write:      true,
+			want:       string(encoded),
+			wantReport: report{Includes: 1, Changed: true},
+		},
+		{
+			name:       "decode and write",
+			src:        string(encoded),
+			encode:     "none",
+			write:      true,
+			want:       normalized,
+			wantReport: report{Encoding: "gzip", Includes: 1, Changed: true},
+		},
+		{
+			name:       "inline",
+			src:        testHeader + testShader,
+			inline:     true,
+			wantReport: report{Includes: 1, Changed: true},
+		},
+		{
+			name:       "inline and write",
+			src:        testHeader + testShader,
+			inline:     true,
+			write:      true,
+			wantReport: report{Includes: 1, Changed: true},
+		},
+		{
+			name:       "CRLF line endings",
+			src:        strings.ReplaceAll(testHeader+testShader, "\n", "\r\n"),
+			wantReport: report{Includes: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeTestFiles(t, tt.src)
+			setFlags(t, tt.normalize, tt.inline, tt.encode, tt.write)
+
+			got := process(filename, irmf.HTTPFetcher{}, nil)
+			want := tt.wantReport
+			want.File, want.IRMFVersion, want.Language, want.Units = filename, "1.0", "glsl", "mm"
+			want.Materials, want.Min, want.Max = []string{"PLA"}, []float64{0, 0, 0}, []float64{1, 1, 1}
+			if !reflect.DeepEqual(*got, want) {
+				t.Errorf("process =\n%+v\nwant\n%+v", *got, want)
+			}
+
+			buf, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := string(buf)
+			switch {
+			case tt.want != "" && out != tt.want:
+				t.Errorf("file =\n%v\nwant\n%v", out, tt.want)
+			case tt.want == "" && !tt.write && out != tt.src:
+				t.Errorf("file changed without -w:\n%v", out)
+			}
+			if tt.inline && tt.write {
+				if strings.Contains(out, "#include") || !strings.Contains(out, testLib) {
+					t.Errorf("inlined file =\n%v\nwant lib/a.glsl inlined", out)
+				}
+			}
+			if _, _, err := irmf.Parse(buf); err != nil {
+				t.Errorf("processed file is invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestProcessErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		inline bool
+		want   []string
+	}{
+		{
+			name: "not an IRMF file",
+			src:  "void main() {}\n",
+			want: []string{`line 1: Unable to find leading "/*{"`},
+		},
+		{
+			name: "header error",
+			src:  strings.Replace(testHeader, `materials: ["PLA"]`, `materials: []`, 1) + testShader,
+			want: []string{"line 4: Invalid JSON blob: "},
+		},
+		{
+			name:   "each include error with its line",
+			src:    testHeader + "#include \"lib/missing1.glsl\"\n" + testShader + "#include \"lib/missing2.glsl\"\n",
+			inline: true,
+			want:   []string{"line 9: unable to include file://", "line 15: unable to include file://"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeTestFiles(t, tt.src)
+			setFlags(t, false, tt.inline, "", true)
+
+			got := process(filename, irmf.HTTPFetcher{}, nil)
+			if len(got.Errors) != len(tt.want) {
+				t.Fatalf("process errors = %q, want %q", got.Errors, tt.want)
+			}
+			for n, want := range tt.want {
+				if !strings.HasPrefix(got.Errors[n], want) {
+					t.Errorf("process errors[%v] = %q, want prefix %q", n, got.Errors[n], want)
+				}
+			}
+			if buf, err := os.ReadFile(filename); err != nil || string(buf) != tt.src {
+				t.Errorf("invalid file was rewritten: (%q, %v)", buf, err)
+			}
+		})
+	}
+}
+
+func TestHeaderEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{name: "LF", src: "/*{\n  \"encoding\": \"gzip\"\n}*/\nbody", want: "gzip"},
+		{name: "CRLF", src: "/*{\r\n  \"encoding\": \"gzip+base64\"\r\n}*/\r\nbody", want: "gzip+base64"},
+		{name: "plain", src: testHeader + testShader},
+		{name: "no header", src: "body"},
+	}
+
+	for _, tt := range tests {
+		if got := headerEncoding([]byte(tt.src)); got != tt.want {
+			t.Errorf("%v: headerEncoding = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// writeTestFiles writes src as model.irmf, along with the lib/a.glsl that
+// it includes, to a temporary directory and returns the name of model.irmf.
+func writeTestFiles(t *testing.T, src string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "lib", "a.glsl"), []byte(testLib), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "model.irmf")
+	if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// setFlags sets the rewriting flags for the duration of the test.
+func setFlags(t *testing.T, n, i bool, e string, w bool) {
+	oldN, oldI, oldE, oldW := *normalize, *inline, *encode, *write
+	*normalize, *inline, *encode, *write = n, i, e, w
+	t.Cleanup(func() {
+		*normalize, *inline, *encode, *write = oldN, oldI, oldE, oldW
+	})
+}
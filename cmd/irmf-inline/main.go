@@ -0,0 +1,88 @@
+// irmf-inline writes a standalone version of an IRMF shader file with all
+// of its "#include" files inlined (and annotated with their origin URLs),
+// so that it can be used by printers and archives without network access.
+//
+// Usage:
+//
+//	irmf-inline [-base url] [-settings settings.json] [-lygia dir] [-o output.irmf] file.irmf
+//
+// Relative includes are resolved against the location of file.irmf
+// unless -base provides the URL that it was originally loaded from.
+// The optional settings file lists include hosts and trusted hosts (see
+// irmf.LoadIncludeSettings). With -lygia, "lygia/..." includes are read
+// from a local mirror written by irmf-lygia. Without -o, the result is
+// written to stdout.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/gmlewis/irmf-editor/irmf"
+)
+
+var (
+	base     = flag.String("base", "", "URL to resolve relative includes against (default is the file's location)")
+	lygia    = flag.String("lygia", "", "Directory of a LYGIA mirror written by irmf-lygia")
+	output   = flag.String("o", "", "Output file (default is stdout)")
+	settings = flag.String("settings", "", "JSON file of include hosts and trusted hosts")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: irmf-inline [-base url] [-settings settings.json] [-lygia dir] [-o output.irmf] file.irmf\n\nInlines all #include files of an IRMF shader.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	filename := flag.Arg(0)
+	if err := inline(filename); err != nil {
+		log.Fatalf("%v: %v", filename, err)
+	}
+}
+
+func inline(filename string) error {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	baseURL := *base
+	if baseURL == "" {
+		if baseURL, err = irmf.FileURL(filename); err != nil {
+			return err
+		}
+	}
+
+	var fetcher irmf.Fetcher = irmf.HTTPFetcher{}
+	if *lygia != "" {
+		mirrorURL, err := irmf.FileURL(*lygia)
+		if err != nil {
+			return err
+		}
+		fetcher = irmf.LygiaMirror(mirrorURL, fetcher)
+	}
+	var trusted *irmf.IncludeSettings
+	if *settings != "" {
+		if trusted, err = irmf.LoadIncludeSettings(*settings); err != nil {
+			return err
+		}
+	}
+
+	out, err := irmf.InlineFile(src, baseURL, fetcher, trusted)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		fmt.Print(out)
+		return nil
+	}
+	return os.WriteFile(*output, []byte(out), 0644)
+}
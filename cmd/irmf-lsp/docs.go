@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gmlewis/irmf-editor/irmf"
+)
+
+// keyDocs documents the keys of the JSON header (irmf.JSONKeys).
+var keyDocs = map[string]string{
+	"author":       "The author of the model.",
+	"license":      `The license of the model, such as "Apache-2.0" or "CC-BY-4.0".`,
+	"date":         `The date of the model, such as "2026-10-19".`,
+	"encoding":     fmt.Sprintf("How the shader body is encoded (e.g. compressed). One of: %v. Omit it for plain text.", quoteAll(irmf.Encodings())),
+	"irmf":         fmt.Sprintf("The version of the IRMF spec that the file follows. Supported versions: %v.", quoteAll(irmf.SupportedVersions())),
+	"glslVersion":  `The GLSL version used by the shader, such as "300 es".`,
+	"includes":     "The include lock: the URL, version (the git ref for GitHub and GitLab files), and SHA-256 of every included file, which are verified whenever the shader is compiled. Once it exists, files that are not in it cannot be included.",
+	"includeHosts": "Maps \"#include\" path prefixes (ending with \"/\") to raw URL templates, where `{path}` is the rest of the include path, `{N}` its Nth segment, and `{N...}` its segments from the Nth onward.",
+	"allowedHosts": `If not empty, the only hosts that included files may be fetched from, among those trusted by the user (lygia.xyz, raw.githubusercontent.com, the host of the file itself, and the allowed hosts of the -settings file). "*.example.com" allows all subdomains of example.com.`,
+	"language":     `The shader language: "glsl" or "wgsl".`,
+	"materials":    "The names of the materials of the model (up to 16). Their number selects the entry point: `mainModel4` (up to 4), `mainModel9` (up to 9), or `mainModel16`.",
+	"max":          "The maximum corner `[x, y, z]` of the model's bounding box, in `units`.",
+	"min":          "The minimum corner `[x, y, z]` of the model's bounding box, in `units`.",
+	"notes":        "Free-form notes about the model.",
+	"options":      "Editor options: `resolution` (32 to 2048) and the material colors `color1` to `color16` as `[r, g, b, a]`.",
+	"title":        "The title of the model.",
+	"units":        fmt.Sprintf("The units of `min` and `max`. One of: %v.", quoteAll(irmf.SupportedUnits())),
+	"version":      "The version of the model itself.",
+}
+
+// entryDoc documents the model entry point entry (e.g. "mainModel4").
+func entryDoc(language, entry string) string {
+	sig := irmf.EntryPointSignature(language, entry)
+	if sig == "" {
+		return ""
+	}
+	n := strings.TrimPrefix(entry, "mainModel")
+	return fmt.Sprintf("```%v\n%v\n```\nThe model's entry point for up to %v materials. It returns the density (0 to 1) of each material at the point `xyz` (in `units`) within the bounding box.", language, sig, n)
+}
+
+func quoteAll(list []string) string {
+	var result []string
+	for _, v := range list {
+		result = append(result, fmt.Sprintf("%q", v))
+	}
+	return strings.Join(result, ", ")
+}
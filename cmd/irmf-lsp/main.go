@@ -0,0 +1,75 @@
+// irmf-lsp is a Language Server Protocol server for IRMF files, so that
+// they can be edited with the same checks and help as the web editor in
+// editors such as VS Code and Neovim.
+//
+// Usage:
+//
+//	irmf-lsp [-settings settings.json] [-lygia dir]
+//
+// It speaks LSP over stdin and stdout and provides:
+//
+//   - diagnostics from validating the file and resolving its includes
+//   - completion of the keys of the JSON header
+//   - hover documentation of header keys, mainModelN, and includes
+//   - go-to-definition of "#include" lines (remote files are downloaded
+//     into the user's cache directory)
+//   - formatting, which formats the JSON header like the web editor
+//
+// The optional settings file lists include hosts and trusted hosts (see
+// irmf.LoadIncludeSettings). With -lygia, "lygia/..." includes are read
+// from a local mirror written by irmf-lygia.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gmlewis/irmf-editor/irmf"
+)
+
+// fetchTimeout limits the time spent fetching each included file.
+const fetchTimeout = 10 * time.Second
+
+var (
+	lygia    = flag.String("lygia", "", "Directory of a LYGIA mirror written by irmf-lygia")
+	settings = flag.String("settings", "", "JSON file of include hosts and trusted hosts")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: irmf-lsp [-settings settings.json] [-lygia dir]\n\nServes the Language Server Protocol for IRMF files over stdin and stdout.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	// stdout is reserved for the protocol.
+	log.SetOutput(os.Stderr)
+	log.SetPrefix("irmf-lsp: ")
+
+	var fetcher irmf.Fetcher = irmf.HTTPFetcher{Client: &http.Client{Timeout: fetchTimeout}}
+	if *lygia != "" {
+		mirrorURL, err := irmf.FileURL(*lygia)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fetcher = irmf.LygiaMirror(mirrorURL, fetcher)
+	}
+	var trusted *irmf.IncludeSettings
+	if *settings != "" {
+		s, err := irmf.LoadIncludeSettings(*settings)
+		if err != nil {
+			log.Fatal(err)
+		}
+		trusted = s
+	}
+
+	s := newServer(newConn(os.Stdin, os.Stdout), fetcher, trusted)
+	os.Exit(s.run())
+}
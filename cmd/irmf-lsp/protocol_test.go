@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestConnRead(t *testing.T) {
+	body := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`
+	notification := `{"jsonrpc":"2.0","method":"initialized"}`
+	input := fmt.Sprintf("Content-Length: %v\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n%v", len(body), body) +
+		fmt.Sprintf("Content-Length: %v\r\n\r\n%v", len(notification), notification)
+	c := newConn(strings.NewReader(input), io.Discard)
+
+	req, err := c.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "initialize" || string(req.ID) != "1" || string(req.Params) != "{}" {
+		t.Errorf("read = %+v, want initialize request 1", req)
+	}
+	if req, err = c.read(); err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "initialized" || req.ID != nil {
+		t.Errorf("read = %+v, want initialized notification", req)
+	}
+	if _, err := c.read(); err != io.EOF {
+		t.Errorf("read at end = %v, want EOF", err)
+	}
+}
+
+func TestConnReadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "missing Content-Length", input: "Content-Type: text/plain\r\n\r\n{}", wantErr: `invalid Content-Length ""`},
+		{name: "malformed Content-Length", input: "Content-Length: ten\r\n\r\n{}", wantErr: `invalid Content-Length "ten"`},
+		{name: "negative Content-Length", input: "Content-Length: -1\r\n\r\n{}", wantErr: `invalid Content-Length "-1"`},
+		{name: "malformed header", input: "Content-Length 2\r\n\r\n{}", wantErr: "malformed MIME header"},
+		{name: "short body", input: "Content-Length: 10\r\n\r\n{}", wantErr: "unexpected EOF"},
+		{name: "invalid JSON", input: "Content-Length: 2\r\n\r\n{]", wantErr: "invalid character"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newConn(strings.NewReader(tt.input), io.Discard).read()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("read err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConnWrite(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newConn(strings.NewReader(""), &buf).reply([]byte("7"), "é"); err != nil {
+		t.Fatal(err)
+	}
+	// Content-Length counts bytes, not characters.
+	if got, want := buf.String(), "Content-Length: 38\r\n\r\n"+`{"jsonrpc":"2.0","id":7,"result":"é"}`; got != want {
+		t.Errorf("reply wrote %q, want %q", got, want)
+	}
+}
+
+func TestOffset(t *testing.T) {
+	tests := []struct {
+		line string
+		char int
+		want int
+	}{
+		{line: "abc", char: 0, want: 0},
+		{line: "abc", char: 2, want: 2},
+		{line: "abc", char: 9, want: 3},
+		// "µ" is 2 bytes and 1 UTF-16 code unit.
+		{line: `"units": "µm"`, char: 11, want: 12},
+		// "😀" is 4 bytes and 2 UTF-16 code units.
+		{line: "// 😀 x", char: 5, want: 7},
+		{line: "// 😀 x", char: 6, want: 8},
+	}
+
+	for _, tt := range tests {
+		if got := offset(tt.line, tt.char); got != tt.want {
+			t.Errorf("offset(%q, %v) = %v, want %v", tt.line, tt.char, got, tt.want)
+		}
+	}
+}
+
+func TestUTF16Len(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{s: "", want: 0},
+		{s: "abc", want: 3},
+		{s: "µm", want: 2},
+		{s: "// 😀 x", want: 7},
+	}
+
+	for _, tt := range tests {
+		if got := utf16Len(tt.s); got != tt.want {
+			t.Errorf("utf16Len(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+
+	d := newDocument("file:///a.irmf", "µm\r\n😀")
+	if got, want := d.lineRange(0).End.Character, 2; got != want {
+		t.Errorf("lineRange(0).End.Character = %v, want %v", got, want)
+	}
+	if got, want := d.fullRange().End, (position{Line: 1, Character: 2}); got != want {
+		t.Errorf("fullRange().End = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gmlewis/irmf-editor/irmf"
+)
+
+// retryInterval is how long a failure to fetch an included file is
+// remembered before it is fetched again.
+const retryInterval = 30 * time.Second
+
+var (
+	includeLineRE = regexp.MustCompile(`^\s*#include\s+"([^"]+)"`)
+	headerKeyRE   = regexp.MustCompile(`^\s*"?(\w+)"?\s*:`)
+	irmfVersionRE = regexp.MustCompile(`"irmf"\s*:\s*"([^"]*)"`)
+	entryPointRE  = regexp.MustCompile(`^mainModel\d+$`)
+)
+
+// server answers the LSP requests of one client.
+type server struct {
+	conn *conn
+	// fetcher retrieves included files.
+	fetcher irmf.Fetcher
+	// trusted holds the user's own include settings, if any.
+	trusted *irmf.IncludeSettings
+	// cacheDir is where included files are downloaded so that the client
+	// can open them (for go-to-definition).
+	cacheDir string
+	docs     map[string]*document
+	shutdown bool
+}
+
+func newServer(c *conn, fetcher irmf.Fetcher, trusted *irmf.IncludeSettings) *server {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return &server{
+		conn:     c,
+		fetcher:  &memoFetcher{Fetcher: fetcher, cache: map[string]memoEntry{}},
+		trusted:  trusted,
+		cacheDir: filepath.Join(cacheDir, "irmf-lsp"),
+		docs:     map[string]*document{},
+	}
+}
+
+// run serves requests until the client exits. It returns the exit code.
+func (s *server) run() int {
+	for {
+		req, err := s.conn.read()
+		var rerr *responseError
+		switch {
+		case errors.As(err, &rerr):
+			s.conn.replyError(json.RawMessage("null"), rerr)
+			continue
+		case err != nil:
+			log.Printf("Unable to read request: %v", err)
+			return 1
+		}
+
+		if req.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+		result, err := s.handle(req)
+		if len(req.ID) == 0 {
+			if err != nil {
+				log.Printf("%v: %v", req.Method, err)
+			}
+			continue // Notifications have no response.
+		}
+		if errors.As(err, &rerr) {
+			err = s.conn.replyError(req.ID, rerr)
+		} else if err != nil {
+			err = s.conn.replyError(req.ID, &responseError{Code: codeInvalidRequest, Message: err.Error()})
+		} else {
+			err = s.conn.reply(req.ID, result)
+		}
+		if err != nil {
+			log.Printf("Unable to reply to %v: %v", req.Method, err)
+			return 1
+		}
+	}
+}
+
+// handle returns the result of req.
+func (s *server) handle(req *request) (interface{}, error) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           textDocumentSyncFull,
+				"completionProvider":         map[string]interface{}{"triggerCharacters": []string{`"`}},
+				"hoverProvider":              true,
+				"definitionProvider":         true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "irmf-lsp"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := unmarshalParams(req, &p); err != nil {
+			return nil, err
+		}
+		return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := unmarshalParams(req, &p); err != nil || len(p.ContentChanges) == 0 {
+			return nil, err
+		}
+		// With full document sync, the last change holds the whole text.
+		return nil, s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+	case "textDocument/didSave":
+		var p documentParams
+		if err := unmarshalParams(req, &p); err != nil {
+			return nil, err
+		}
+		if d, ok := s.docs[p.TextDocument.URI]; ok {
+			return nil, s.publishDiagnostics(d) // Included files may have changed.
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var p documentParams
+		if err := unmarshalParams(req, &p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, s.conn.notify(publishDiagnosticsEvent, &publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []diagnostic{}})
+	case "textDocument/completion":
+		return s.withPosition(req, s.completion)
+	case "textDocument/hover":
+		return s.withPosition(req, s.hover)
+	case "textDocument/definition":
+		return s.withPosition(req, s.definition)
+	case "textDocument/formatting":
+		var p documentParams
+		if err := unmarshalParams(req, &p); err != nil {
+			return nil, err
+		}
+		d, ok := s.docs[p.TextDocument.URI]
+		if !ok {
+			return nil, nil
+		}
+		return s.format(d), nil
+	}
+	if strings.HasPrefix(req.Method, "$/") {
+		return nil, nil // Optional notifications may be ignored.
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not supported: %v", req.Method)}
+}
+
+func unmarshalParams(req *request, v interface{}) error {
+	if err := json.Unmarshal(req.Params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// withPosition calls fn with the open document and position of req.
+func (s *server) withPosition(req *request, fn func(d *document, pos position) interface{}) (interface{}, error) {
+	var p textDocumentPositionParams
+	if err := unmarshalParams(req, &p); err != nil {
+		return nil, err
+	}
+	d, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	return fn(d, p.Position), nil
+}
+
+// update records the new text of the document uri and publishes its diagnostics.
+func (s *server) update(uri, text string) error {
+	d := newDocument(uri, text)
+	s.docs[uri] = d
+	return s.publishDiagnostics(d)
+}
+
+func (s *server) publishDiagnostics(d *document) error {
+	return s.conn.notify(publishDiagnosticsEvent, &publishDiagnosticsParams{URI: d.uri, Diagnostics: s.diagnose(d)})
+}
+
+// diagnose returns the problems found by parsing and validating d and
+// by expanding its includes.
+func (s *server) diagnose(d *document) []diagnostic {
+	result := []diagnostic{}
+	addLine := func(line int, msg string) {
+		line = max(line, 1) - 1 // Errors without a location are shown on the first line.
+		result = append(result, diagnostic{Range: d.lineRange(line), Severity: severityError, Source: diagnosticsSource, Message: msg})
+	}
+	add := func(err error) {
+		var lineErrs []*irmf.LineError
+		var includeErrs irmf.IncludeErrors
+		var lineErr *irmf.LineError
+		switch {
+		case errors.As(err, &includeErrs):
+			lineErrs = includeErrs
+		case errors.As(err, &lineErr):
+			lineErrs = []*irmf.LineError{lineErr}
+		default:
+			lineErrs = []*irmf.LineError{{Err: err}}
+		}
+		for _, e := range lineErrs {
+			addLine(e.Line, e.Error())
+		}
+	}
+
+	jsonBlob, shaderSrc, err := irmf.Parse([]byte(d.text))
+	if err != nil {
+		add(err)
+		return result
+	}
+	for _, w := range jsonBlob.Warnings() {
+		result = append(result, diagnostic{Range: d.lineRange(max(w.Line, 1) - 1), Severity: severityWarning, Source: diagnosticsSource, Message: w.Error()})
+	}
+
+	// Includes are expanded within the whole file (whose header is a
+	// comment) so that their errors are reported on the lines of the file.
+	src, encoded := d.text, !strings.HasSuffix(d.text, shaderSrc)
+	if encoded {
+		src = shaderSrc
+	}
+	opts := irmf.IncludeOptions{BaseURL: d.uri, Language: jsonBlob.Language}
+	if _, err := irmf.ExpandIncludes(src, opts, jsonBlob.VerifyingFetcher(jsonBlob.IncludeFetcher(s.fetcher, d.uri, s.trusted))); err != nil {
+		if encoded {
+			// The lines of the decoded shader are not lines of the file.
+			addLine(irmf.FindKeyLine(d.text, "encoding"), err.Error())
+		} else {
+			add(err)
+		}
+	}
+	return result
+}
+
+// headerEnd returns the 0-based line of the "}*/" that ends the JSON
+// header of d, or -1 if it has none.
+func (d *document) headerEnd() int {
+	if !strings.HasPrefix(d.text, "/*{") {
+		return -1
+	}
+	for n := range d.lines {
+		if strings.HasPrefix(d.line(n), "}*/") {
+			return n
+		}
+	}
+	return -1
+}
+
+// language returns the shader language of d.
+func (d *document) language() string {
+	if jsonBlob, _, err := irmf.Parse([]byte(d.text)); err == nil {
+		return jsonBlob.Language
+	}
+	if end := d.headerEnd(); end >= 0 {
+		return irmf.DetectLanguage(strings.Join(d.lines[end+1:], "\n"))
+	}
+	return irmf.DetectLanguage(d.text)
+}
+
+// includeFetcher returns s.fetcher with the include settings of d's header
+// (see irmf.IRMF.IncludeFetcher).
+func (s *server) includeFetcher(d *document) irmf.Fetcher {
+	jsonBlob, _, err := irmf.Parse([]byte(d.text))
+	if err != nil {
+		jsonBlob = &irmf.IRMF{}
+	}
+	return jsonBlob.IncludeFetcher(s.fetcher, d.uri, s.trusted)
+}
+
+func isWordChar(c rune) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// wordAt returns the identifier of line around the byte offset i.
+func wordAt(line string, i int) string {
+	start, end := i, i
+	for start > 0 && isWordChar(rune(line[start-1])) {
+		start--
+	}
+	for end < len(line) && isWordChar(rune(line[end])) {
+		end++
+	}
+	return line[start:end]
+}
+
+// completion offers the header keys (of the header's IRMF version) that
+// are not yet used when pos is within the JSON header.
+func (s *server) completion(d *document, pos position) interface{} {
+	end := d.headerEnd()
+	if pos.Line < 1 || pos.Line >= end {
+		return []completionItem{}
+	}
+	used := map[string]bool{}
+	version := irmf.LatestVersion
+	for n := 1; n < end; n++ {
+		if m := irmfVersionRE.FindStringSubmatch(d.line(n)); m != nil {
+			version = m[1]
+		}
+		if n == pos.Line {
+			continue
+		}
+		if m := headerKeyRE.FindStringSubmatch(d.line(n)); m != nil {
+			used[m[1]] = true
+		}
+	}
+	keys := irmf.VersionKeys(version)
+	if keys == nil {
+		keys = irmf.VersionKeys(irmf.LatestVersion)
+	}
+
+	line := d.line(pos.Line)
+	before := line[:offset(line, pos.Character)]
+	quoted := strings.HasSuffix(strings.TrimRightFunc(before, isWordChar), `"`)
+	items := []completionItem{}
+	for _, key := range keys {
+		if used[key] {
+			continue
+		}
+		item := completionItem{
+			Label:         key,
+			Kind:          completionKindProperty,
+			Documentation: &markupContent{Kind: markupKindMarkdown, Value: keyDocs[key]},
+			InsertText:    fmt.Sprintf("%q: ", key),
+		}
+		if quoted {
+			item.InsertText = key
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// hover documents the header key, model entry point, or include at pos.
+func (s *server) hover(d *document, pos position) interface{} {
+	line := d.line(pos.Line)
+	if m := includeLineRE.FindStringSubmatch(line); m != nil {
+		if url := s.includeFetcher(d).Resolve(m[1], d.uri, d.language()); url != "" {
+			return &hover{Contents: markupContent{Kind: markupKindMarkdown, Value: fmt.Sprintf("Includes %v", url)}}
+		}
+		return nil
+	}
+
+	word := wordAt(line, offset(line, pos.Character))
+	var doc string
+	switch {
+	case pos.Line > 0 && pos.Line < d.headerEnd():
+		if doc = keyDocs[word]; doc != "" {
+			doc = fmt.Sprintf("**%v**: %v", word, doc)
+		}
+	case entryPointRE.MatchString(word):
+		doc = entryDoc(d.language(), word)
+	}
+	if doc == "" {
+		return nil
+	}
+	return &hover{Contents: markupContent{Kind: markupKindMarkdown, Value: doc}}
+}
+
+// definition returns the location of the file included by the
+// "#include" line at pos. Remote files are downloaded to s.cacheDir.
+func (s *server) definition(d *document, pos position) interface{} {
+	m := includeLineRE.FindStringSubmatch(d.line(pos.Line))
+	if m == nil {
+		return nil
+	}
+	fetcher := s.includeFetcher(d)
+	rawURL := fetcher.Resolve(m[1], d.uri, d.language())
+	if rawURL == "" {
+		return nil
+	}
+	if strings.HasPrefix(rawURL, "file:") {
+		return &location{URI: rawURL}
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	buf, err := fetcher.Fetch(rawURL)
+	if err != nil {
+		log.Printf("Unable to fetch %v: %v", rawURL, err)
+		return nil
+	}
+	filename := filepath.Join(s.cacheDir, u.Hostname(), filepath.FromSlash(path.Clean("/"+u.Path)))
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		log.Print(err)
+		return nil
+	}
+	if err := os.WriteFile(filename, buf, 0644); err != nil {
+		log.Print(err)
+		return nil
+	}
+	fileURL, err := irmf.FileURL(filename)
+	if err != nil {
+		return nil
+	}
+	return &location{URI: fileURL}
+}
+
+// format returns the edits that reformat d like the editor does, or none
+// if d cannot be parsed. Encoded shader bodies keep their encoding.
+func (s *server) format(d *document) []textEdit {
+	jsonBlob, shaderSrc, err := irmf.Parse([]byte(d.text))
+	if err != nil {
+		return []textEdit{}
+	}
+	// Parse decodes the shader body, so get its encoding from the header.
+	var encoding string
+	if header, _, ok := irmf.SplitFile([]byte(d.text)); ok {
+		if h, err := irmf.ParseJSON(header); err == nil && h.Encoding != nil {
+			encoding = *h.Encoding
+		}
+	}
+	formatted, err := jsonBlob.Encode(shaderSrc, encoding)
+	if err != nil || string(formatted) == d.text {
+		return []textEdit{}
+	}
+	return []textEdit{{Range: d.fullRange(), NewText: string(formatted)}}
+}
+
+// memoFetcher remembers the files (other than local files, which may be
+// edited) fetched by its Fetcher, so that the includes are not fetched
+// again whenever the document changes.
+type memoFetcher struct {
+	irmf.Fetcher
+	cache map[string]memoEntry
+}
+
+type memoEntry struct {
+	buf []byte
+	err error
+	at  time.Time
+}
+
+func (f *memoFetcher) Fetch(rawURL string) ([]byte, error) {
+	if strings.HasPrefix(rawURL, "file:") {
+		return f.Fetcher.Fetch(rawURL)
+	}
+	if e, ok := f.cache[rawURL]; ok && (e.err == nil || time.Since(e.at) < retryInterval) {
+		return e.buf, e.err
+	}
+	buf, err := f.Fetcher.Fetch(rawURL)
+	f.cache[rawURL] = memoEntry{buf: buf, err: err, at: time.Now()}
+	return buf, err
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gmlewis/irmf-editor/irmf"
+)
+
+const testHeader = `/*{
+  "irmf": "1.0",
+  "language": "glsl",
+  "materials": ["PLA"],
+  "max": [1,1,1],
+  "min": [0,0,0],
+  "units": "mm"
+}*/
+`
+
+const testShader = `#include "lygia/math/const.glsl"
+#include "lygia/missing.glsl"
+
+void mainModel4(out vec4 materials, in vec3 xyz) {
+  materials[0] = 1.0;
+}
+`
+
+func newTestServer() *server {
+	fetcher := irmf.MemoryFetcher{"https://lygia.xyz/math/const.glsl": "#define PI 3.14159"}
+	return newServer(newConn(strings.NewReader(""), io.Discard), fetcher, nil)
+}
+
+func TestDiagnose(t *testing.T) {
+	jsonBlob, shaderSrc, err := irmf.Parse([]byte(testHeader + testShader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := jsonBlob.Encode(shaderSrc, "gzip+base64")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		wantLine int
+		wantErr  string
+	}{
+		{
+			name:     "include error on its line",
+			text:     testHeader + testShader,
+			wantLine: 9,
+			wantErr:  "https://lygia.xyz/missing.glsl",
+		},
+		{
+			name:     "include error of an encoded file on its encoding",
+			text:     string(encoded),
+			wantLine: strings.Count(string(encoded)[:strings.Index(string(encoded), `"encoding"`)], "\n"),
+			wantErr:  "https://lygia.xyz/missing.glsl",
+		},
+		{
+			name:     "header error on its key",
+			text:     strings.Replace(testHeader, `"materials": ["PLA"]`, `"materials": []`, 1) + testShader,
+			wantLine: 3,
+			wantErr:  "at least one material",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDocument("file:///tmp/model.irmf", tt.text)
+			got := newTestServer().diagnose(d)
+			if len(got) != 1 {
+				t.Fatalf("diagnose = %+v, want 1 diagnostic", got)
+			}
+			if got[0].Range.Start.Line != tt.wantLine || got[0].Severity != severityError || !strings.Contains(got[0].Message, tt.wantErr) {
+				t.Errorf("diagnose = %+v, want error on line %v containing %q", got[0], tt.wantLine, tt.wantErr)
+			}
+			if want := utf16Len(d.line(tt.wantLine)); got[0].Range.End.Character != want {
+				t.Errorf("diagnose range ends at character %v, want %v", got[0].Range.End.Character, want)
+			}
+		})
+	}
+}
+
+func TestDiagnoseValid(t *testing.T) {
+	text := testHeader + strings.Replace(testShader, "#include \"lygia/missing.glsl\"\n", "", 1)
+	if got := newTestServer().diagnose(newDocument("file:///tmp/model.irmf", text)); len(got) != 0 {
+		t.Errorf("diagnose = %+v, want none", got)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	jsonBlob, shaderSrc, err := irmf.Parse([]byte(testHeader + testShader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted, err := jsonBlob.Format(shaderSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := jsonBlob.Encode(shaderSrc, "gzip+base64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An unformatted header of an encoded file.
+	header, body, _ := irmf.SplitFile(encoded)
+	unformatted := "/*" + strings.ReplaceAll(header, "\n  ", "\n") + "*/\n" + string(body)
+
+	tests := []struct {
+		name string
+		text string
+		// want is the formatted document; "" means no edits.
+		want string
+	}{
+		{name: "plain", text: testHeader + testShader, want: formatted},
+		{name: "formatted", text: formatted},
+		{name: "encoded", text: unformatted, want: string(encoded)},
+		{name: "formatted encoded", text: string(encoded)},
+		{name: "invalid", text: "void main() {}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits := newTestServer().format(newDocument("file:///tmp/model.irmf", tt.text))
+			if tt.want == "" {
+				if len(edits) != 0 {
+					t.Errorf("format = %+v, want no edits", edits)
+				}
+				return
+			}
+			if len(edits) != 1 || edits[0].NewText != tt.want {
+				t.Errorf("format = %+v, want\n%v", edits, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		line     int
+		want     []string
+		wantNone []string
+	}{
+		{
+			// The key on the line being completed is not used yet.
+			name:     "skips used keys",
+			header:   testHeader,
+			line:     6,
+			want:     []string{"author", "encoding", "title", "units"},
+			wantNone: []string{"irmf", "language", "materials", "max", "min"},
+		},
+		{
+			name:     "IRMF 1.0 keys only",
+			header:   testHeader,
+			line:     6,
+			wantNone: []string{"includes", "includeHosts", "allowedHosts"},
+		},
+		{
+			name:   "IRMF 1.1 keys",
+			header: strings.Replace(testHeader, `"irmf": "1.0"`, `"irmf": "1.1"`, 1),
+			line:   6,
+			want:   []string{"includes", "includeHosts", "allowedHosts"},
+		},
+		{
+			name:   "the key being typed is offered",
+			header: strings.Replace(testHeader, `"units": "mm"`, `"un`, 1),
+			line:   6,
+			want:   []string{"units"},
+		},
+		{
+			name:   "outside of the header",
+			header: testHeader,
+			line:   9,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDocument("file:///tmp/model.irmf", tt.header+testShader)
+			items := newTestServer().completion(d, position{Line: tt.line, Character: utf16Len(d.line(tt.line))}).([]completionItem)
+			got := map[string]bool{}
+			for _, item := range items {
+				got[item.Label] = true
+			}
+			for _, key := range tt.want {
+				if !got[key] {
+					t.Errorf("completion is missing %q", key)
+				}
+			}
+			for _, key := range tt.wantNone {
+				if got[key] {
+					t.Errorf("completion offers %q", key)
+				}
+			}
+			if tt.want == nil && tt.wantNone == nil && len(items) != 0 {
+				t.Errorf("completion = %+v, want none", items)
+			}
+		})
+	}
+}
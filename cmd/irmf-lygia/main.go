@@ -0,0 +1,86 @@
+// irmf-lygia mirrors the LYGIA files included (directly or indirectly) by
+// IRMF shaders into a local directory, so that they can be built and
+// viewed without depending on https://lygia.xyz.
+//
+// Usage:
+//
+//	irmf-lygia [-o lygia] [-settings settings.json] file.irmf|dir...
+//
+// Directories are searched for .irmf files. Relative includes are resolved
+// against the location of each file. The optional settings file lists
+// include hosts and trusted hosts (see irmf.LoadIncludeSettings).
+//
+// The mirror is then used by "irmf-serve -lygia lygia" (for the editor)
+// and "irmf-inline -lygia lygia", which read "lygia/..." includes from it
+// without network access.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/gmlewis/irmf-editor/irmf"
+)
+
+var (
+	output   = flag.String("o", "lygia", "Directory of the LYGIA mirror")
+	settings = flag.String("settings", "", "JSON file of include hosts and trusted hosts")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: irmf-lygia [-o lygia] [-settings settings.json] file.irmf|dir...\n\nMirrors the LYGIA files included by IRMF shaders.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var fetcher irmf.Fetcher = irmf.HTTPFetcher{}
+	var trusted *irmf.IncludeSettings
+	if *settings != "" {
+		s, err := irmf.LoadIncludeSettings(*settings)
+		if err != nil {
+			log.Fatal(err)
+		}
+		trusted = s
+	}
+
+	filenames, err := irmf.FindFiles(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	mirrored := map[string]bool{}
+	var failed bool
+	for _, filename := range filenames {
+		paths, err := mirror(filename, fetcher, trusted)
+		if err != nil {
+			log.Printf("%v: %v", filename, err)
+			failed = true
+			continue
+		}
+		for _, p := range paths {
+			mirrored[p] = true
+		}
+	}
+	log.Printf("Mirrored %v LYGIA files from %v shaders into %v", len(mirrored), len(filenames), *output)
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func mirror(filename string, fetcher irmf.Fetcher, trusted *irmf.IncludeSettings) ([]string, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	baseURL, err := irmf.FileURL(filename)
+	if err != nil {
+		return nil, err
+	}
+	return irmf.MirrorLygia(src, baseURL, *output, fetcher, trusted)
+}
@@ -0,0 +1,80 @@
+// irmf-migrate upgrades IRMF shader files to a newer IRMF spec version
+// supported by the irmf-editor and reports what changed.
+//
+// Usage:
+//
+//	irmf-migrate [-to version] [-w] file.irmf ...
+//
+// The default version is the newest published one; draft versions (which
+// other IRMF tools do not accept yet) must be requested with -to.
+// Without -w, the migrated files are written to stdout.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gmlewis/irmf-editor/irmf"
+)
+
+var (
+	to    = flag.String("to", irmf.LatestVersion, fmt.Sprintf("IRMF version to migrate to (supported versions: %v)", strings.Join(irmf.SupportedVersions(), ", ")))
+	write = flag.Bool("w", false, "Write the migrated result back to the source file instead of stdout")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: irmf-migrate [-to version] [-w] file.irmf ...\n\nUpgrades IRMF files to IRMF %v (or the -to version).\n\n", irmf.LatestVersion)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if irmf.IsDraftVersion(*to) {
+		log.Printf("warning: IRMF %v is a draft that other IRMF tools (such as the irmf-slicer) do not accept yet", *to)
+	}
+
+	var failed bool
+	for _, filename := range flag.Args() {
+		if err := migrate(filename); err != nil {
+			log.Printf("%v: %v", filename, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func migrate(filename string) error {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	out, changes, err := irmf.MigrateFile(src, *to)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		log.Printf("%v: already at IRMF %v", filename, *to)
+	}
+	for _, change := range changes {
+		log.Printf("%v: %v", filename, change)
+	}
+
+	if !*write {
+		fmt.Print(out)
+		return nil
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return os.WriteFile(filename, []byte(out), 0644)
+}
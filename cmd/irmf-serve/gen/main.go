@@ -0,0 +1,239 @@
+// gen prepares the files embedded by irmf-serve: it copies the editor's
+// files, builds main.wasm, and downloads (vendors) the JavaScript
+// dependencies that the editor otherwise loads from CDNs. Downloads are
+// kept between runs, so only the first run requires internet access.
+//
+// Every download is verified against the SHA-256 hash pinned next to its
+// URL below before it is written. When a dependency is added or upgraded,
+// run with -record to print the hashes of the downloads so that they can
+// be reviewed and pinned.
+//
+// Usage (from cmd/irmf-serve, as run by "go generate"):
+//
+//	go run ./gen -root ../.. -out assets [-record]
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	// cdnURL is where the editor loads its dependencies from.
+	cdnURL = "https://cdnjs.cloudflare.com/ajax/libs/"
+
+	// monacoTarball is the npm package of the Monaco editor, which
+	// consists of too many files to download individually.
+	monacoTarball = "https://registry.npmjs.org/monaco-editor/-/monaco-editor-0.20.0.tgz"
+	monacoSHA256  = ""
+	monacoDir     = "monaco-editor/0.20.0/min/vs"
+)
+
+// pinnedFile is a file to download along with the hex-encoded SHA-256
+// hash of its expected content.
+type pinnedFile struct {
+	name   string
+	sha256 string
+}
+
+var (
+	root   = flag.String("root", "../..", "Root directory of the irmf-editor")
+	out    = flag.String("out", "assets", "Output directory")
+	record = flag.Bool("record", false, "Accept downloads without pinned hashes and print their hashes to pin")
+
+	// siteFiles are copied from root.
+	siteFiles = []string{"index.html", "favicon.ico", "css", "images", "js"}
+
+	// vendored are downloaded from cdnURL into out/vendor.
+	vendored = []pinnedFile{
+		{name: "split.js/1.5.11/split.min.js", sha256: ""},
+		{name: "three.js/110/three.min.js", sha256: ""},
+		{name: "dat-gui/0.7.6/dat.gui.min.js", sha256: ""},
+	}
+)
+
+func main() {
+	flag.Parse()
+
+	for _, name := range siteFiles {
+		if err := copyAll(filepath.Join(*root, name), filepath.Join(*out, name)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := copyFile(filepath.Join(wasmExecDir(), "wasm_exec.js"), filepath.Join(*out, "js", "wasm_exec.js")); err != nil {
+		log.Fatal(err)
+	}
+	if err := buildWASM(); err != nil {
+		log.Fatal(err)
+	}
+
+	vendorDir := filepath.Join(*out, "vendor")
+	for _, f := range vendored {
+		if err := download(cdnURL+f.name, f.sha256, filepath.Join(vendorDir, filepath.FromSlash(f.name))); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := downloadMonaco(filepath.Join(vendorDir, filepath.FromSlash(monacoDir))); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Done. Now build irmf-serve.")
+}
+
+// wasmExecDir returns the directory of the wasm_exec.js matching this Go version.
+func wasmExecDir() string {
+	dir := filepath.Join(runtime.GOROOT(), "lib", "wasm")
+	if _, err := os.Stat(dir); err != nil {
+		return filepath.Join(runtime.GOROOT(), "misc", "wasm") // Before Go 1.24.
+	}
+	return dir
+}
+
+func buildWASM() error {
+	output, err := filepath.Abs(filepath.Join(*out, "main.wasm"))
+	if err != nil {
+		return err
+	}
+	log.Printf("Building %v", output)
+	cmd := exec.Command("go", "build", "-o", output, ".")
+	cmd.Dir = *root
+	cmd.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm")
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// copyAll copies the file or directory tree src to dst.
+func copyAll(src, dst string) error {
+	return filepath.Walk(src, func(name string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		return copyFile(name, filepath.Join(dst, rel))
+	})
+}
+
+func copyFile(src, dst string) error {
+	buf, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeFile(dst, buf)
+}
+
+func writeFile(name string, buf []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, buf, 0644)
+}
+
+// get returns the body of rawURL after verifying it against want, the
+// hex-encoded SHA-256 hash pinned for rawURL.
+func get(rawURL, want string) ([]byte, error) {
+	log.Printf("Downloading %v", rawURL)
+	resp, err := http.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %v: %v", rawURL, resp.Status)
+	}
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(rawURL, buf, want); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// verify checks that the SHA-256 hash of buf (the content of rawURL) is
+// want. With -record, a missing hash is accepted and the hash is printed.
+func verify(rawURL string, buf []byte, want string) error {
+	sum := sha256.Sum256(buf)
+	got := hex.EncodeToString(sum[:])
+	switch {
+	case got == want:
+		return nil
+	case want == "" && *record:
+		log.Printf("Recorded %v\n\tsha256: %q", rawURL, got)
+		return nil
+	case want == "":
+		return fmt.Errorf("no SHA-256 hash is pinned for %v (got %v); review the download and run with -record to pin it", rawURL, got)
+	}
+	return fmt.Errorf("SHA-256 mismatch for %v: got %v, want %v", rawURL, got, want)
+}
+
+// download saves rawURL as filename, unless it has already been
+// downloaded. Both new and previously downloaded files are verified
+// against want.
+func download(rawURL, want, filename string) error {
+	if buf, err := os.ReadFile(filename); err == nil {
+		if err := verify(rawURL, buf, want); err != nil {
+			return fmt.Errorf("%v: %w (delete it to download it again)", filename, err)
+		}
+		return nil
+	}
+	buf, err := get(rawURL, want)
+	if err != nil {
+		return err
+	}
+	return writeFile(filename, buf)
+}
+
+// downloadMonaco extracts the "min/vs" directory of the Monaco editor's
+// npm package into dir, unless it has already been downloaded. The
+// package is verified against monacoSHA256 before anything is extracted.
+func downloadMonaco(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, "loader.js")); err == nil {
+		return nil
+	}
+	buf, err := get(monacoTarball, monacoSHA256)
+	if err != nil {
+		return err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+
+	const prefix = "package/min/vs/"
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg || !strings.HasPrefix(hdr.Name, prefix) || strings.Contains(hdr.Name, "..") {
+			continue
+		}
+		buf, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(hdr.Name[len(prefix):])), buf); err != nil {
+			return err
+		}
+	}
+}
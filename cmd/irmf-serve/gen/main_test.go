@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testContent = "console.log('vendored')\n"
+
+func testHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		record  bool
+		wantErr string
+	}{
+		{name: "match", want: testHash(testContent)},
+		{name: "match with -record", want: testHash(testContent), record: true},
+		{name: "mismatch", want: testHash("other"), wantErr: "SHA-256 mismatch"},
+		{name: "mismatch with -record", want: testHash("other"), record: true, wantErr: "SHA-256 mismatch"},
+		{name: "missing hash", wantErr: "no SHA-256 hash is pinned"},
+		{name: "missing hash with -record", record: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRecord(t, tt.record)
+			err := verify("https://example.com/a.js", []byte(testContent), tt.want)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("verify: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("verify err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownload(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/a.js" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testContent))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		record  bool
+		wantErr string
+	}{
+		{name: "match", path: "/a.js", want: testHash(testContent)},
+		{name: "mismatch", path: "/a.js", want: testHash("other"), wantErr: "SHA-256 mismatch"},
+		{name: "missing hash", path: "/a.js", wantErr: "no SHA-256 hash is pinned"},
+		{name: "missing hash with -record", path: "/a.js", record: true},
+		{name: "not found", path: "/b.js", want: testHash(testContent), wantErr: "404"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRecord(t, tt.record)
+			filename := filepath.Join(t.TempDir(), "vendor", "a.js")
+			err := download(srv.URL+tt.path, tt.want, filename)
+			buf, readErr := os.ReadFile(filename)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("download err = %v, want %q", err, tt.wantErr)
+				}
+				if readErr == nil {
+					t.Errorf("download wrote %q despite the error", buf)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("download: %v", err)
+			}
+			if string(buf) != testContent {
+				t.Errorf("download wrote %q, want %q", buf, testContent)
+			}
+		})
+	}
+
+	// Files that were already downloaded are verified without downloading them again.
+	setRecord(t, false)
+	filename := filepath.Join(t.TempDir(), "a.js")
+	if err := os.WriteFile(filename, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before := requests
+	if err := download(srv.URL+"/a.js", testHash(testContent), filename); err == nil || !strings.Contains(err.Error(), "delete it to download it again") {
+		t.Errorf("download of a tampered file err = %v, want mismatch", err)
+	}
+	if err := download(srv.URL+"/a.js", testHash("tampered"), filename); err != nil {
+		t.Errorf("download of a downloaded file: %v", err)
+	}
+	if requests != before {
+		t.Errorf("downloaded files were fetched %v more times, want 0", requests-before)
+	}
+}
+
+// setRecord sets the -record flag for the duration of the test.
+func setRecord(t *testing.T, v bool) {
+	old := *record
+	*record = v
+	t.Cleanup(func() { *record = old })
+}
@@ -0,0 +1,157 @@
+// irmf-serve serves the complete irmf-editor (including its JavaScript
+// dependencies, which are otherwise loaded from CDNs) from a single binary,
+// so that it works on machines without internet access.
+//
+// Usage:
+//
+//	irmf-serve [-addr localhost:8080] [-watch dir] [-lygia dir]
+//
+// With -watch, the .irmf files in dir (and the .glsl and .wgsl files that
+// they include with relative paths) are served from the local filesystem
+// and the editor reloads them whenever any of them changes, so that they
+// can be edited with other editors. Open http://localhost:8080/?watch=model.irmf
+// to view dir/model.irmf.
+//
+// With -lygia, "lygia/..." includes are read from a local mirror written
+// by irmf-lygia rather than from https://lygia.xyz.
+//
+// The editor's files are embedded when irmf-serve is built, so first run:
+//
+//	go generate ./cmd/irmf-serve
+//	go build ./cmd/irmf-serve
+package main
+
+//go:generate go run ./gen -root ../.. -out assets
+
+import (
+	"bytes"
+	"embed"
+	"flag"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cdnPrefix is where index.html and js/startup.js load their dependencies
+// from. It is rewritten to the vendored copies in assets/vendor.
+const cdnPrefix = "https://cdnjs.cloudflare.com/ajax/libs/"
+
+// lygiaPath is where the files of the LYGIA mirror are served.
+const lygiaPath = "/lygia/"
+
+var (
+	addr  = flag.String("addr", "localhost:8080", "Address to serve the editor on")
+	watch = flag.String("watch", "", "Directory of .irmf files to serve and reload whenever they change")
+	lygia = flag.String("lygia", "", "Directory of a LYGIA mirror written by irmf-lygia")
+
+	//go:embed all:assets
+	assets embed.FS
+
+	// contentTypes are set explicitly so that they do not depend on the
+	// system's MIME types. Browsers require application/wasm to compile
+	// main.wasm while it streams.
+	contentTypes = map[string]string{
+		".css":  "text/css; charset=utf-8",
+		".html": "text/html; charset=utf-8",
+		".ico":  "image/x-icon",
+		".js":   "text/javascript; charset=utf-8",
+		".png":  "image/png",
+		".svg":  "image/svg+xml",
+		".ttf":  "font/ttf",
+		".wasm": "application/wasm",
+	}
+
+	// startTime is the modification time of all the embedded files.
+	startTime = time.Now()
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: irmf-serve [-addr localhost:8080] [-watch dir] [-lygia dir]\n\nServes the irmf-editor without internet access.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	site, err := fs.Sub(assets, "assets")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, name := range []string{"index.html", "main.wasm", "vendor"} {
+		if _, err := fs.Stat(site, name); err != nil {
+			log.Fatalf("irmf-serve was built without %v; run 'go generate ./cmd/irmf-serve' and build it again", name)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", newHandler(site, *lygia != ""))
+	if *lygia != "" {
+		if _, err := os.Stat(*lygia); err != nil {
+			log.Fatal(err)
+		}
+		mux.Handle(lygiaPath, serveLygia(*lygia))
+		log.Printf("Serving LYGIA includes from %v", *lygia)
+	}
+	if *watch != "" {
+		w := &watcher{dir: *watch}
+		w.register(mux)
+		w.logURLs(*addr)
+	}
+
+	log.Printf("Serving the irmf-editor on http://%v/", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+// newHandler returns a handler that serves the files of site, with the
+// CDN URLs within its HTML and JavaScript pointing to its vendor directory.
+// If mirror is set, its HTML pages point the editor to the LYGIA mirror.
+func newHandler(site fs.FS, mirror bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if name == "" {
+			name = "index.html"
+		}
+		buf, err := fs.ReadFile(site, name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		ext := path.Ext(name)
+		if ct, ok := contentTypes[ext]; ok {
+			w.Header().Set("Content-Type", ct)
+		}
+		if ext == ".html" || ext == ".js" {
+			// Absolute URLs are needed by Monaco's web workers.
+			buf = bytes.ReplaceAll(buf, []byte(cdnPrefix), []byte("http://"+r.Host+"/vendor/"))
+		}
+		if ext == ".html" && mirror {
+			meta := fmt.Sprintf("<meta name=\"lygia-mirror\" content=\"http://%v%v\">\n</head>", html.EscapeString(r.Host), lygiaPath)
+			buf = bytes.Replace(buf, []byte("</head>"), []byte(meta), 1)
+		}
+		http.ServeContent(w, r, name, startTime, bytes.NewReader(buf))
+	})
+}
+
+// serveLygia serves the shader files of the LYGIA mirror in dir.
+func serveLygia(dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, lygiaPath))[1:]
+		if ext := path.Ext(name); ext != ".glsl" && ext != ".wgsl" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		http.ServeFile(w, r, filepath.Join(dir, filepath.FromSlash(name)))
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNewHandler(t *testing.T) {
+	site := fstest.MapFS{
+		"index.html":    {Data: []byte("<html><head>\n<script src=\"" + cdnPrefix + "three.js/r110/three.min.js\"></script>\n</head></html>\n")},
+		"js/startup.js": {Data: []byte("require.config({ paths: { vs: '" + cdnPrefix + "monaco-editor/0.20.0/min/vs' } })\n")},
+		"main.wasm":     {Data: []byte("\x00asm")},
+		"css/style.css": {Data: []byte("body { color: " + cdnPrefix + " }\n")},
+	}
+
+	tests := []struct {
+		name            string
+		path            string
+		mirror          bool
+		wantStatus      int
+		wantContentType string
+		want            []string
+		wantNone        []string
+	}{
+		{
+			name:            "index with vendored dependencies",
+			path:            "/",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/html; charset=utf-8",
+			want:            []string{`src="http://example.com:8080/vendor/three.js/r110/three.min.js"`},
+			wantNone:        []string{cdnPrefix, "lygia-mirror"},
+		},
+		{
+			name:            "index with the LYGIA mirror",
+			path:            "/index.html",
+			mirror:          true,
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/html; charset=utf-8",
+			want:            []string{"<meta name=\"lygia-mirror\" content=\"http://example.com:8080/lygia/\">\n</head>"},
+		},
+		{
+			name:            "JavaScript with vendored dependencies",
+			path:            "/js/startup.js",
+			mirror:          true,
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/javascript; charset=utf-8",
+			want:            []string{"'http://example.com:8080/vendor/monaco-editor/0.20.0/min/vs'"},
+			wantNone:        []string{cdnPrefix, "lygia-mirror"},
+		},
+		{
+			name:            "other files are not rewritten",
+			path:            "/css/style.css",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/css; charset=utf-8",
+			want:            []string{cdnPrefix},
+		},
+		{
+			name:            "WebAssembly",
+			path:            "/main.wasm",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/wasm",
+			want:            []string{"\x00asm"},
+		},
+		{
+			name:       "missing",
+			path:       "/missing.js",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "outside of the site",
+			path:       "/../main.go",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newHandler(site, tt.mirror).ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com:8080"+tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Content-Type"); tt.wantContentType != "" && got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			body := rec.Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("body =\n%v\nwant %q", body, want)
+				}
+			}
+			for _, want := range tt.wantNone {
+				if strings.Contains(body, want) {
+					t.Errorf("body =\n%v\nwant no %q", body, want)
+				}
+			}
+		})
+	}
+}
+
+func TestServeLygia(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "lygia")
+	writeFile(t, filepath.Join(dir, "math", "const.glsl"), "#define PI 3.14159")
+	writeFile(t, filepath.Join(dir, "math", "const.wgsl"), "const PI = 3.14159;")
+	writeFile(t, filepath.Join(dir, "README.md"), "# LYGIA")
+	writeFile(t, filepath.Join(root, "secret.glsl"), "secret")
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       string
+	}{
+		{path: "/lygia/math/const.glsl", wantStatus: http.StatusOK, want: "#define PI 3.14159"},
+		{path: "/lygia/math/const.wgsl", wantStatus: http.StatusOK, want: "const PI = 3.14159;"},
+		{path: "/lygia/README.md", wantStatus: http.StatusNotFound},
+		{path: "/lygia/math/", wantStatus: http.StatusNotFound},
+		{path: "/lygia/math/missing.glsl", wantStatus: http.StatusNotFound},
+		// http.ServeFile rejects paths with "..", which would otherwise
+		// be kept within dir.
+		{path: "/lygia/%2e%2e/secret.glsl", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			serveLygia(dir).ServeHTTP(rec, httptest.NewRequest("GET", "http://localhost:8080"+tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if strings.Contains(rec.Body.String(), "secret") {
+				t.Fatalf("served a file outside of the mirror: %q", rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+				t.Errorf("Content-Type = %q, want text/plain", got)
+			}
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeFile writes content to filename, creating its directory.
+func writeFile(t *testing.T, filename, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
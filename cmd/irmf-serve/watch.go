@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// filesPath is where the files of the watched directory are served.
+	filesPath = "/files/"
+	// eventsPath is where the page subscribes to changes of a watched file.
+	eventsPath = "/events"
+	// pollInterval is how often the watched directory is checked for changes.
+	pollInterval = 250 * time.Millisecond
+)
+
+// watchedExtensions are the files that are served and watched.
+var watchedExtensions = map[string]bool{".irmf": true, ".glsl": true, ".wgsl": true}
+
+// watcher serves the IRMF shaders (and their includes) of a local directory
+// and pushes their changes to the editor with server-sent events.
+type watcher struct {
+	dir string
+}
+
+// fileState identifies a version of a file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// changeEvent is sent to the page when the watched file or any other
+// file of the directory (such as one of its includes) changes.
+type changeEvent struct {
+	// Changed are the URLs of the changed files.
+	Changed []string `json:"changed"`
+	// Source is the new content of the watched file.
+	Source string `json:"source"`
+}
+
+// register adds the watcher's handlers to mux.
+func (w *watcher) register(mux *http.ServeMux) {
+	mux.HandleFunc(filesPath, w.serveFile)
+	mux.HandleFunc(eventsPath, w.serveEvents)
+}
+
+// logURLs logs the URL to open for each IRMF file in the directory.
+func (w *watcher) logURLs(addr string) {
+	states, err := w.scan()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var names []string
+	for name := range states {
+		if path.Ext(name) == ".irmf" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		log.Printf("No .irmf files found in %v", w.dir)
+	}
+	for _, name := range names {
+		log.Printf("Live view of %v: http://%v/?watch=%v", name, addr, url.QueryEscape(name))
+	}
+}
+
+// scan returns the state of every watched file in the directory,
+// keyed by its slash-separated path relative to the directory.
+func (w *watcher) scan() (map[string]fileState, error) {
+	result := map[string]fileState{}
+	err := filepath.WalkDir(w.dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !watchedExtensions[filepath.Ext(name)] {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(w.dir, name)
+		if err != nil {
+			return err
+		}
+		result[filepath.ToSlash(rel)] = fileState{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	return result, err
+}
+
+// localName returns the local filename of the slash-separated relative
+// path name, or "" if it is not a watched file within the directory.
+func (w *watcher) localName(name string) string {
+	name = path.Clean("/" + name)[1:]
+	if name == "" || !watchedExtensions[path.Ext(name)] {
+		return ""
+	}
+	return filepath.Join(w.dir, filepath.FromSlash(name))
+}
+
+func (w *watcher) serveFile(rw http.ResponseWriter, r *http.Request) {
+	filename := w.localName(strings.TrimPrefix(r.URL.Path, filesPath))
+	if filename == "" {
+		http.NotFound(rw, r)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-cache")
+	http.ServeFile(rw, r, filename)
+}
+
+// serveEvents sends a changeEvent whenever a file of the directory changes,
+// until the page disconnects. The "file" parameter is the watched file.
+func (w *watcher) serveEvents(rw http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("file")
+	filename := w.localName(name)
+	flusher, ok := rw.(http.Flusher)
+	if filename == "" || !ok {
+		http.Error(rw, fmt.Sprintf("unable to watch %q", name), http.StatusBadRequest)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+	log.Printf("Watching %v for %v", name, r.RemoteAddr)
+
+	baseURL := "http://" + r.Host + filesPath
+	last, err := w.scan()
+	if err != nil {
+		log.Printf("Unable to watch %v: %v", w.dir, err)
+		return
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("Stopped watching %v for %v", name, r.RemoteAddr)
+			return
+		case <-ticker.C:
+		}
+
+		states, err := w.scan()
+		if err != nil {
+			log.Printf("Unable to watch %v: %v", w.dir, err)
+			continue
+		}
+		var changed []string
+		for rel, state := range states {
+			if last[rel] != state {
+				changed = append(changed, baseURL+rel)
+			}
+		}
+		for rel := range last {
+			if _, ok := states[rel]; !ok {
+				changed = append(changed, baseURL+rel)
+			}
+		}
+		last = states
+		if len(changed) == 0 {
+			continue
+		}
+
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			log.Printf("Unable to read %v: %v", filename, err)
+			continue
+		}
+		sort.Strings(changed)
+		buf, err := json.Marshal(&changeEvent{Changed: changed, Source: string(src)})
+		if err != nil {
+			log.Printf("Unable to send changes: %v", err)
+			continue
+		}
+		log.Printf("Sending changes to %v: %v", r.RemoteAddr, strings.Join(changed, ", "))
+		fmt.Fprintf(rw, "data: %s\n\n", buf)
+		flusher.Flush()
+	}
+}
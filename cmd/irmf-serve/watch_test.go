@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testModel = "/*{\n  \"irmf\": \"1.0\"\n}*/\n#include \"lib/a.glsl\"\n"
+
+func TestLocalName(t *testing.T) {
+	w := &watcher{dir: t.TempDir()}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "model.irmf", want: "model.irmf"},
+		{name: "lib/a.glsl", want: "lib/a.glsl"},
+		{name: "lib/../b.wgsl", want: "b.wgsl"},
+		// Paths are kept within the directory.
+		{name: "../secret.irmf", want: "secret.irmf"},
+		{name: "lib/../../../secret.glsl", want: "secret.glsl"},
+		{name: "/etc/passwd.glsl", want: "etc/passwd.glsl"},
+		{name: "notes.txt"},
+		{name: "../main.go"},
+		{name: ""},
+		{name: ".."},
+	}
+
+	for _, tt := range tests {
+		want := tt.want
+		if want != "" {
+			want = filepath.Join(w.dir, filepath.FromSlash(want))
+		}
+		if got := w.localName(tt.name); got != want {
+			t.Errorf("localName(%q) = %q, want %q", tt.name, got, want)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	w := &watcher{dir: t.TempDir()}
+	writeFile(t, filepath.Join(w.dir, "model.irmf"), testModel)
+	writeFile(t, filepath.Join(w.dir, "lib", "a.glsl"), "float a;")
+	writeFile(t, filepath.Join(w.dir, "lib", "b.wgsl"), "const b = 1.0;")
+	writeFile(t, filepath.Join(w.dir, "notes.txt"), "notes")
+
+	states, err := w.scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for name := range states {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	if want := []string{"lib/a.glsl", "lib/b.wgsl", "model.irmf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("scan = %v, want %v", got, want)
+	}
+	if got, want := states["lib/a.glsl"].size, int64(len("float a;")); got != want {
+		t.Errorf("scan size = %v, want %v", got, want)
+	}
+}
+
+func TestServeFile(t *testing.T) {
+	w := &watcher{dir: t.TempDir()}
+	writeFile(t, filepath.Join(w.dir, "lib", "a.glsl"), "float a;")
+	writeFile(t, filepath.Join(w.dir, "notes.txt"), "notes")
+	mux := http.NewServeMux()
+	w.register(mux)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       string
+	}{
+		{path: "/files/lib/a.glsl", wantStatus: http.StatusOK, want: "float a;"},
+		{path: "/files/notes.txt", wantStatus: http.StatusNotFound},
+		{path: "/files/lib/missing.glsl", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "http://localhost:8080"+tt.path, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%v: status = %v, want %v", tt.path, rec.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus == http.StatusOK {
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("%v: body = %q, want %q", tt.path, got, tt.want)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != "no-cache" {
+				t.Errorf("%v: Cache-Control = %q, want no-cache", tt.path, got)
+			}
+		}
+	}
+}
+
+func TestServeEvents(t *testing.T) {
+	w := &watcher{dir: t.TempDir()}
+	writeFile(t, filepath.Join(w.dir, "model.irmf"), testModel)
+	writeFile(t, filepath.Join(w.dir, "lib", "a.glsl"), "float a;")
+	mux := http.NewServeMux()
+	w.register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + eventsPath + "?file=notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("events of notes.txt: status = %v, want %v", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+eventsPath+"?file=model.irmf", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	// The watcher takes its first scan after the response starts, so
+	// keep changing the include until a change is sent.
+	done, stopped := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		content := "float a;"
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(pollInterval / 2):
+			}
+			content += "\n"
+			os.WriteFile(filepath.Join(w.dir, "lib", "a.glsl"), []byte(content), 0644)
+		}
+	}()
+
+	event := readEvent(t, resp.Body)
+	if want := []string{srv.URL + filesPath + "lib/a.glsl"}; !reflect.DeepEqual(event.Changed, want) {
+		t.Errorf("changed = %v, want %v", event.Changed, want)
+	}
+	if event.Source != testModel {
+		t.Errorf("source = %q, want %q", event.Source, testModel)
+	}
+}
+
+// readEvent returns the next changeEvent sent as a server-sent event.
+func readEvent(t *testing.T, r io.Reader) *changeEvent {
+	t.Helper()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event changeEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", data, err)
+		}
+		return &event
+	}
+	t.Fatalf("no event was sent: %v", scanner.Err())
+	return nil
+}
@@ -0,0 +1,109 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+	"time"
+
+	"github.com/gmlewis/irmf-editor/irmf"
+)
+
+// historyMaxVersions is the number of versions of the editor buffer kept.
+const historyMaxVersions = 20
+
+// history holds the versions of the editor buffer that compiled successfully.
+var history = irmf.NewHistory(browserStore(), historyMaxVersions)
+
+// autosave enables snapshots once the initial shader has been loaded.
+var autosave bool
+
+// pendingSnapshot is the editor buffer (and its title) most recently sent
+// to the compiler, which is saved to the version history once it compiles.
+var pendingSnapshot *irmf.Snapshot
+
+// compileSucceededCallback saves the buffer that was just compiled
+// successfully to the version history.
+func compileSucceededCallback(this js.Value, args []js.Value) interface{} {
+	s := pendingSnapshot
+	pendingSnapshot = nil
+	if s == nil {
+		return nil
+	}
+	if _, err := history.Save(s.Source, s.Title); err != nil {
+		logf("Unable to save the editor buffer to the version history: %v", err)
+	}
+	return nil
+}
+
+// historyVersion returns the version numbered by args[0] (1 is the newest).
+func historyVersion(name string, args []js.Value) *irmf.Snapshot {
+	if len(args) != 1 {
+		logf("%v: expected 1 arg, got %v", name, len(args))
+		return nil
+	}
+	n := args[0].Int()
+	versions := history.Versions()
+	if n < 1 || n > len(versions) {
+		logf("No version %v; there are %v versions", n, len(versions))
+		return nil
+	}
+	return versions[n-1]
+}
+
+// snapshotName describes s for lists and diffs.
+func snapshotName(s *irmf.Snapshot) string {
+	title := s.Title
+	if title == "" {
+		title = "(untitled)"
+	}
+	return fmt.Sprintf("%v, saved %v", title, s.SavedAt.Local().Format(time.RFC1123))
+}
+
+// listHistoryCallback logs the saved versions and returns how many there are.
+func listHistoryCallback(this js.Value, args []js.Value) interface{} {
+	versions := history.Versions()
+	logf("Version history: %v of at most %v versions, newest first:", len(versions), historyMaxVersions)
+	for i, s := range versions {
+		logf("%v: %v", i+1, snapshotName(s))
+	}
+	return len(versions)
+}
+
+// diffHistoryCallback logs the changes from the version numbered by args[0]
+// to the editor buffer, and reports whether that version exists.
+func diffHistoryCallback(this js.Value, args []js.Value) interface{} {
+	s := historyVersion("diffHistory", args)
+	if s == nil {
+		return false
+	}
+	diff := irmf.Diff(snapshotName(s), "editor", s.Source, editor.Call("getValue").String())
+	if diff == "" {
+		logf("Version %v is identical to the editor buffer", args[0].Int())
+		return true
+	}
+	logPre(diff)
+	return true
+}
+
+// restoreHistoryCallback replaces the editor buffer with the version
+// numbered by args[0]. The editor buffer is saved to the history first.
+func restoreHistoryCallback(this js.Value, args []js.Value) interface{} {
+	s := historyVersion("restoreHistory", args)
+	if s == nil {
+		return nil
+	}
+	src := editor.Call("getValue").String()
+	title := ""
+	if jsonBlob, _, err := irmf.Parse([]byte(src)); err == nil {
+		title = jsonBlob.Title
+	}
+	if _, err := history.Save(src, title); err != nil {
+		logf("Unable to save the editor buffer to the version history: %v", err)
+	}
+
+	clearLog()
+	logf("Restoring %v", snapshotName(s))
+	return initShader([]byte(s.Source))
+}
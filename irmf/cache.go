@@ -0,0 +1,251 @@
+package irmf
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cacheKeyPrefix prefixes the keys of all include cache entries in a
+	// CacheStore so that the store may be shared with other data.
+	cacheKeyPrefix = "irmf-include:"
+	// cacheIndexKey is the key of the index of all include cache entries
+	// (without their bodies), so that they can be listed and evicted
+	// without reading every body.
+	cacheIndexKey = "irmf-include-index"
+)
+
+// CacheStore is the persistent key/value storage behind an IncludeCache
+// (or a History), such as the browser's localStorage.
+type CacheStore interface {
+	Get(key string) (string, bool)
+	Set(key, value string) error
+	Delete(key string)
+	Keys() []string
+}
+
+// MemoryCacheStore is a CacheStore that keeps everything in memory.
+type MemoryCacheStore struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+// NewMemoryCacheStore returns an empty MemoryCacheStore.
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return &MemoryCacheStore{m: map[string]string{}}
+}
+
+// Get returns the value of key, if present.
+func (s *MemoryCacheStore) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.m[key]
+	return v, ok
+}
+
+// Set sets the value of key.
+func (s *MemoryCacheStore) Set(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[key] = value
+	return nil
+}
+
+// Delete removes key.
+func (s *MemoryCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+}
+
+// Keys returns all keys in the store.
+func (s *MemoryCacheStore) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []string
+	for k := range s.m {
+		result = append(result, k)
+	}
+	return result
+}
+
+// CacheEntry describes one cached included file.
+type CacheEntry struct {
+	URL       string    `json:"url"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	ETag      string    `json:"etag,omitempty"`
+	Size      int       `json:"size"`
+}
+
+// storedEntry is the serialized form of a cache entry and its body.
+type storedEntry struct {
+	CacheEntry
+	Body string `json:"body"`
+}
+
+// IncludeCache is a persistent cache of included files whose entries
+// expire after TTL and whose total size is limited to MaxBytes by
+// evicting the oldest entries first.
+type IncludeCache struct {
+	store CacheStore
+	// TTL is how long an entry is fresh. Stale entries are still
+	// available (e.g. when offline) with LookupStale.
+	TTL time.Duration
+	// MaxBytes limits the total size of all cached bodies.
+	MaxBytes int
+
+	now func() time.Time
+}
+
+// NewIncludeCache returns an IncludeCache backed by store.
+func NewIncludeCache(store CacheStore, ttl time.Duration, maxBytes int) *IncludeCache {
+	return &IncludeCache{store: store, TTL: ttl, MaxBytes: maxBytes, now: time.Now}
+}
+
+func (c *IncludeCache) load(url string) (*storedEntry, bool) {
+	v, ok := c.store.Get(cacheKeyPrefix + url)
+	if !ok {
+		return nil, false
+	}
+	e := &storedEntry{}
+	if err := json.Unmarshal([]byte(v), e); err != nil {
+		c.store.Delete(cacheKeyPrefix + url) // Corrupt; drop it.
+		return nil, false
+	}
+	return e, true
+}
+
+// Get returns the cached body of url if it is present and fresh.
+func (c *IncludeCache) Get(url string) ([]byte, bool) {
+	e, ok := c.load(url)
+	if !ok || c.now().Sub(e.FetchedAt) > c.TTL {
+		return nil, false
+	}
+	return []byte(e.Body), true
+}
+
+// LookupStale returns the cached body of url even if it has expired.
+func (c *IncludeCache) LookupStale(url string) ([]byte, *CacheEntry, bool) {
+	e, ok := c.load(url)
+	if !ok {
+		return nil, nil, false
+	}
+	return []byte(e.Body), &e.CacheEntry, true
+}
+
+// Put caches body as the content of url, evicting the oldest entries
+// as needed to stay within MaxBytes. Bodies larger than MaxBytes are
+// not cached. etag (if any) is the ETag of body, for revalidating it
+// once it has expired.
+func (c *IncludeCache) Put(url string, body []byte, etag string) error {
+	if len(body) > c.MaxBytes {
+		return nil
+	}
+	index := c.loadIndex()
+	c.deleteEntry(index, url)
+	var entries []CacheEntry
+	total := len(body)
+	for _, e := range index {
+		entries = append(entries, e)
+		total += e.Size
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].FetchedAt.Before(entries[b].FetchedAt) })
+	for len(entries) > 0 && total > c.MaxBytes {
+		c.deleteEntry(index, entries[0].URL)
+		total -= entries[0].Size
+		entries = entries[1:]
+	}
+
+	entry := CacheEntry{URL: url, FetchedAt: c.now(), ETag: etag, Size: len(body)}
+	buf, err := json.Marshal(&storedEntry{CacheEntry: entry, Body: string(body)})
+	if err != nil {
+		return err
+	}
+	for {
+		err := c.store.Set(cacheKeyPrefix+url, string(buf))
+		if err == nil {
+			break
+		}
+		if len(entries) == 0 {
+			c.saveIndex(index)
+			return err
+		}
+		// The store itself is full (e.g. a browser quota); make more room.
+		c.deleteEntry(index, entries[0].URL)
+		entries = entries[1:]
+	}
+	index[url] = entry
+	return c.saveIndex(index)
+}
+
+// Refresh marks the (possibly expired) cached copy of url as freshly
+// fetched, such as when the server reports that its ETag is still current.
+func (c *IncludeCache) Refresh(url string) error {
+	e, ok := c.load(url)
+	if !ok {
+		return nil
+	}
+	return c.Put(url, []byte(e.Body), e.ETag)
+}
+
+// Delete removes url from the cache.
+func (c *IncludeCache) Delete(url string) {
+	index := c.loadIndex()
+	c.deleteEntry(index, url)
+	c.saveIndex(index)
+}
+
+// deleteEntry removes url from the store and from index.
+func (c *IncludeCache) deleteEntry(index map[string]CacheEntry, url string) {
+	c.store.Delete(cacheKeyPrefix + url)
+	delete(index, url)
+}
+
+// loadIndex returns the entries of the cache keyed by URL. A missing
+// (or corrupt) index is rebuilt from the entries themselves.
+func (c *IncludeCache) loadIndex() map[string]CacheEntry {
+	index := map[string]CacheEntry{}
+	if v, ok := c.store.Get(cacheIndexKey); ok && json.Unmarshal([]byte(v), &index) == nil {
+		return index
+	}
+	index = map[string]CacheEntry{}
+	for _, key := range c.store.Keys() {
+		url, ok := strings.CutPrefix(key, cacheKeyPrefix)
+		if !ok {
+			continue
+		}
+		if e, ok := c.load(url); ok {
+			index[url] = e.CacheEntry
+		}
+	}
+	return index
+}
+
+func (c *IncludeCache) saveIndex(index map[string]CacheEntry) error {
+	buf, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return c.store.Set(cacheIndexKey, string(buf))
+}
+
+// Entries returns all cached entries, sorted by URL.
+func (c *IncludeCache) Entries() []CacheEntry {
+	var result []CacheEntry
+	for _, e := range c.loadIndex() {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(a, b int) bool { return result[a].URL < result[b].URL })
+	return result
+}
+
+// Clear removes all entries from the cache.
+func (c *IncludeCache) Clear() {
+	for url := range c.loadIndex() {
+		c.store.Delete(cacheKeyPrefix + url)
+	}
+	c.store.Delete(cacheIndexKey)
+}
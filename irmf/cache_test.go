@@ -0,0 +1,158 @@
+package irmf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncludeCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewIncludeCache(NewMemoryCacheStore(), time.Hour, 10)
+	c.now = func() time.Time { return now }
+
+	if err := c.Put("a", []byte("aaaa"), `"etag-a"`); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	if err := c.Put("b", []byte("bbbb"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c.Get("a"); !ok || string(got) != "aaaa" {
+		t.Errorf("Get(a) = (%q, %v), want (aaaa, true)", got, ok)
+	}
+
+	// Exceeding MaxBytes evicts the oldest entry.
+	now = now.Add(time.Minute)
+	if err := c.Put("c", []byte("cccc"), ""); err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, e := range c.Entries() {
+		urls = append(urls, e.URL)
+	}
+	if got := strings.Join(urls, ","); got != "b,c" {
+		t.Errorf("Entries = %v, want b,c", got)
+	}
+
+	// Bodies larger than MaxBytes are not cached.
+	if err := c.Put("big", []byte("0123456789x"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("big"); ok {
+		t.Error("Get(big) found an entry larger than MaxBytes")
+	}
+
+	// Expired entries are only available with LookupStale.
+	now = now.Add(2 * time.Hour)
+	if _, ok := c.Get("b"); ok {
+		t.Error("Get(b) returned an expired entry")
+	}
+	body, entry, ok := c.LookupStale("b")
+	if !ok || string(body) != "bbbb" || entry.Size != 4 {
+		t.Errorf("LookupStale(b) = (%q, %+v, %v)", body, entry, ok)
+	}
+
+	c.Clear()
+	if entries := c.Entries(); len(entries) != 0 {
+		t.Errorf("Entries after Clear = %+v", entries)
+	}
+}
+
+// quotaStore is a CacheStore that rejects new keys once it holds max keys.
+type quotaStore struct {
+	*MemoryCacheStore
+	max int
+}
+
+func (s *quotaStore) Set(key, value string) error {
+	if _, ok := s.Get(key); !ok && len(s.Keys()) >= s.max {
+		return errors.New("quota exceeded")
+	}
+	return s.MemoryCacheStore.Set(key, value)
+}
+
+func TestIncludeCacheQuota(t *testing.T) {
+	// Room for the unrelated key, the cache index, and one entry.
+	store := &quotaStore{MemoryCacheStore: NewMemoryCacheStore(), max: 3}
+	store.Set("unrelated", "value")
+	c := NewIncludeCache(store, time.Hour, 1<<20)
+	for _, url := range []string{"a", "b", "c"} {
+		if err := c.Put(url, []byte(url), ""); err != nil {
+			t.Fatalf("Put(%v): %v", url, err)
+		}
+	}
+	if _, ok := c.Get("c"); !ok {
+		t.Error("Put did not evict older entries when the store was full")
+	}
+	if _, ok := store.Get("unrelated"); !ok {
+		t.Error("Put evicted an unrelated key")
+	}
+}
+
+// countingStore is a CacheStore that counts the reads of cached bodies.
+type countingStore struct {
+	*MemoryCacheStore
+	bodyReads int
+}
+
+func (s *countingStore) Get(key string) (string, bool) {
+	if strings.HasPrefix(key, cacheKeyPrefix) {
+		s.bodyReads++
+	}
+	return s.MemoryCacheStore.Get(key)
+}
+
+func TestIncludeCacheIndex(t *testing.T) {
+	store := &countingStore{MemoryCacheStore: NewMemoryCacheStore()}
+	c := NewIncludeCache(store, time.Hour, 1<<20)
+	for _, url := range []string{"a", "b", "c"} {
+		if err := c.Put(url, []byte(url+url), `"`+url+`"`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Delete("b")
+	if store.bodyReads != 0 {
+		t.Errorf("Put and Delete read %v cached bodies, want 0", store.bodyReads)
+	}
+	entries := c.Entries()
+	if len(entries) != 2 || entries[0].URL != "a" || entries[0].ETag != `"a"` || entries[0].Size != 2 || entries[1].URL != "c" {
+		t.Errorf("Entries = %+v, want a and c", entries)
+	}
+	if store.bodyReads != 0 {
+		t.Errorf("Entries read %v cached bodies, want 0", store.bodyReads)
+	}
+
+	// Caches written before the index existed are indexed from their entries.
+	store.Delete(cacheIndexKey)
+	if got := c.Entries(); len(got) != 2 || got[0].URL != "a" || got[1].URL != "c" {
+		t.Errorf("Entries without an index = %+v, want a and c", got)
+	}
+}
+
+func TestIncludeCacheRefresh(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewIncludeCache(NewMemoryCacheStore(), time.Hour, 1<<20)
+	c.now = func() time.Time { return now }
+	if err := c.Put("a", []byte("aaaa"), `"etag-a"`); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("Get(a) returned an expired entry")
+	}
+	if err := c.Refresh("a"); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c.Get("a"); !ok || string(got) != "aaaa" {
+		t.Errorf("Get(a) after Refresh = (%q, %v), want (aaaa, true)", got, ok)
+	}
+	if _, entry, _ := c.LookupStale("a"); entry.ETag != `"etag-a"` || !entry.FetchedAt.Equal(now) {
+		t.Errorf("LookupStale(a) after Refresh = %+v, want the same ETag fetched now", entry)
+	}
+	if err := c.Refresh("missing"); err != nil {
+		t.Errorf("Refresh(missing) = %v, want nil", err)
+	}
+}
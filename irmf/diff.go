@@ -0,0 +1,117 @@
+package irmf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffCells limits the work done by Diff (the product of the numbers
+// of lines of both files).
+const maxDiffCells = 4 << 20
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// Diff returns a unified diff (with 3 lines of context) that changes the
+// text a (named aName) into b (named bName), or "" if they are identical.
+func Diff(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+	if len(x)*len(y) > maxDiffCells {
+		return fmt.Sprintf("--- %v\n+++ %v\n(files too large to compare: %v and %v lines)\n", aName, bName, len(x), len(y))
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			switch {
+			case x[i] == y[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	// ops is the edit script: ' ' (unchanged), '-' (from x), or '+' (from y).
+	type op struct {
+		kind byte
+		line string
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			ops = append(ops, op{' ', x[i]})
+			i++
+			j++
+		case j == len(y) || (i < len(x) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', x[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', y[j]})
+			j++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %v\n+++ %v\n", aName, bName)
+	// Group the changes into hunks, each with diffContext lines around it.
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+		first := max(start-diffContext, 0)
+		end, unchanged := start, 0
+		for end < len(ops) && unchanged <= 2*diffContext {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+			end++
+		}
+		end -= max(unchanged-diffContext, 0)
+
+		aLine, bLine := 1, 1
+		for _, o := range ops[:first] {
+			if o.kind != '+' {
+				aLine++
+			}
+			if o.kind != '-' {
+				bLine++
+			}
+		}
+		var aCount, bCount int
+		for _, o := range ops[first:end] {
+			if o.kind != '+' {
+				aCount++
+			}
+			if o.kind != '-' {
+				bCount++
+			}
+		}
+		if aCount == 0 {
+			aLine-- // An empty range starts after the line before it.
+		}
+		if bCount == 0 {
+			bLine--
+		}
+		fmt.Fprintf(&sb, "@@ -%v,%v +%v,%v @@\n", aLine, aCount, bLine, bCount)
+		for _, o := range ops[first:end] {
+			fmt.Fprintf(&sb, "%c%v\n", o.kind, o.line)
+		}
+		start = end
+	}
+	return sb.String()
+}
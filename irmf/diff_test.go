@@ -0,0 +1,65 @@
+package irmf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	lines := func(from, to int) string {
+		var result []string
+		for i := from; i <= to; i++ {
+			result = append(result, fmt.Sprintf("line %v", i))
+		}
+		return strings.Join(result, "\n")
+	}
+
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{name: "identical", a: "a\nb", b: "a\nb", want: ""},
+		{
+			name: "change",
+			a:    "a\nb\nc",
+			b:    "a\nB\nc",
+			want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "insert at start",
+			a:    "b",
+			b:    "a\nb",
+			want: "--- old\n+++ new\n@@ -1,1 +1,2 @@\n+a\n b\n",
+		},
+		{
+			name: "delete everything",
+			a:    "a",
+			b:    "",
+			want: "--- old\n+++ new\n@@ -1,1 +1,1 @@\n-a\n+\n",
+		},
+		{
+			name: "separate hunks",
+			a:    lines(1, 20),
+			b:    strings.Replace(strings.Replace(lines(1, 20), "line 2\n", "", 1), "line 18", "line eighteen", 1),
+			want: "--- old\n+++ new\n@@ -1,5 +1,4 @@\n line 1\n-line 2\n line 3\n line 4\n line 5\n" +
+				"@@ -15,6 +14,6 @@\n line 15\n line 16\n line 17\n-line 18\n+line eighteen\n line 19\n line 20\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			a:    lines(1, 10),
+			b:    strings.Replace(strings.Replace(lines(1, 10), "line 2\n", "", 1), "line 8", "line eight", 1),
+			want: "--- old\n+++ new\n@@ -1,10 +1,9 @@\n line 1\n-line 2\n line 3\n line 4\n line 5\n line 6\n line 7\n-line 8\n+line eight\n line 9\n line 10\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff("old", "new", tt.a, tt.b); got != tt.want {
+				t.Errorf("Diff =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
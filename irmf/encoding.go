@@ -0,0 +1,205 @@
+package irmf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// codec compresses and decompresses a shader body.
+type codec struct {
+	name       string
+	compress   func(data []byte) ([]byte, error)
+	decompress func(data []byte) ([]byte, error)
+}
+
+// codecs is the registry of supported compression formats.
+// Each codec is also available with a "+base64" suffix, and the
+// plain "base64" encoding is the identity codec with base64.
+var codecs = []*codec{
+	{name: "gzip", compress: gzipBytes, decompress: gunzip},
+	{name: "zlib", compress: zlibBytes, decompress: unzlib},
+	{name: "deflate", compress: deflateBytes, decompress: inflate},
+}
+
+const base64Suffix = "+base64"
+
+// Encodings returns the names of all supported shader body encodings.
+func Encodings() []string {
+	var result []string
+	for _, c := range codecs {
+		result = append(result, c.name, c.name+base64Suffix)
+	}
+	return append(result, "base64")
+}
+
+// lookupEncoding returns the codec (nil for plain "base64") and whether
+// the body is base64-encoded for the named encoding.
+func lookupEncoding(encoding string) (*codec, bool, error) {
+	if encoding == "base64" {
+		return nil, true, nil
+	}
+	name := strings.TrimSuffix(encoding, base64Suffix)
+	for _, c := range codecs {
+		if c.name == name {
+			return c, name != encoding, nil
+		}
+	}
+	return nil, false, fmt.Errorf("unsupported encoding %q", encoding)
+}
+
+// decodeBody decodes the shader body according to the header's encoding.
+func decodeBody(encoding string, body []byte) (string, error) {
+	if encoding == "" {
+		return string(body), nil
+	}
+	c, isBase64, err := lookupEncoding(encoding)
+	if err != nil {
+		return "", err
+	}
+
+	data := body
+	if isBase64 {
+		// Be lenient about line-wrapping and padding produced by other tools.
+		s := strings.Join(strings.Fields(string(body)), "")
+		if data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "=")); err != nil {
+			return "", fmt.Errorf("uudecode error: %v", err)
+		}
+	}
+	if c != nil {
+		if data, err = c.decompress(data); err != nil {
+			return "", fmt.Errorf("%v: %v", c.name, err)
+		}
+	}
+	return string(data), nil
+}
+
+// encodeBody encodes the shader source with the given encoding.
+func encodeBody(encoding, shaderSrc string) ([]byte, error) {
+	if encoding == "" {
+		return []byte(shaderSrc), nil
+	}
+	c, isBase64, err := lookupEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	data := []byte(shaderSrc)
+	if c != nil {
+		if data, err = c.compress(data); err != nil {
+			return nil, fmt.Errorf("%v: %v", c.name, err)
+		}
+	}
+	if isBase64 {
+		data = []byte(base64.RawStdEncoding.EncodeToString(data))
+	}
+	return data, nil
+}
+
+// MaxDecodedSize is the largest decompressed shader body (or share link)
+// that is accepted, so that a small crafted input cannot exhaust memory.
+const MaxDecodedSize = 16 << 20
+
+// readAllAndClose reads r to EOF (up to MaxDecodedSize bytes) and then
+// closes it, which also verifies the checksum for formats that have one.
+func readAllAndClose(r io.ReadCloser) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if _, err := io.Copy(buf, io.LimitReader(r, MaxDecodedSize+1)); err != nil {
+		return nil, err
+	}
+	if buf.Len() > MaxDecodedSize {
+		return nil, fmt.Errorf("decompressed data exceeds %v bytes", MaxDecodedSize)
+	}
+	if err := r.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeAndClose writes data to w and then closes (flushes) it.
+func writeAndClose(w io.WriteCloser, data []byte) error {
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return readAllAndClose(zr)
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := writeAndClose(gzip.NewWriter(buf), data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func unzlib(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return readAllAndClose(zr)
+}
+
+func zlibBytes(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := writeAndClose(zlib.NewWriter(buf), data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	return readAllAndClose(flate.NewReader(bytes.NewReader(data)))
+}
+
+func deflateBytes(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw, err := flate.NewWriter(buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeAndClose(zw, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Encode returns the complete IRMF file with its shader body encoded
+// using encoding (one of Encodings(); "" means plain text)
+// and the header's "encoding" key set accordingly.
+// The result round-trips through Parse, returning the identical shaderSrc.
+// The receiver is not modified.
+func (i *IRMF) Encode(shaderSrc, encoding string) ([]byte, error) {
+	body, err := encodeBody(encoding, shaderSrc)
+	if err != nil {
+		return nil, err
+	}
+
+	header := *i
+	header.Encoding = nil
+	if encoding != "" {
+		header.Encoding = &encoding
+	}
+	if err := header.validateEncoding(); err != nil {
+		return nil, err
+	}
+
+	h, err := header.Format("")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(h), body...), nil
+}
@@ -0,0 +1,178 @@
+package irmf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	shaders := []string{
+		testShader,
+		"// Unicode: µm ±0.1\r\n" + testShader + "\n\n   \t",
+		strings.Repeat(testShader, 100),
+	}
+
+	for _, encoding := range append([]string{""}, Encodings()...) {
+		for n, shaderSrc := range shaders {
+			jsonBlob := &IRMF{IRMFVersion: "1.1", Language: "glsl", Materials: []string{"PLA"}, Min: []float64{0, 0, 0}, Max: []float64{1, 1, 1}, Units: "mm"}
+			buf, err := jsonBlob.Encode(shaderSrc, encoding)
+			if err != nil {
+				t.Fatalf("Encode(%v, %q): %v", n, encoding, err)
+			}
+			if jsonBlob.Encoding != nil {
+				t.Errorf("Encode(%v, %q) modified the receiver", n, encoding)
+			}
+			if encoding != "" && !strings.Contains(string(buf), `"encoding": "`+encoding+`"`) {
+				t.Errorf("Encode(%v, %q) missing encoding key:\n%s", n, encoding, buf)
+			}
+
+			got, gotSrc, err := Parse(buf)
+			if err != nil {
+				t.Fatalf("Parse(Encode(%v, %q)): %v", n, encoding, err)
+			}
+			if gotSrc != shaderSrc {
+				t.Errorf("Parse(Encode(%v, %q)) shaderSrc = %q, want %q", n, encoding, gotSrc, shaderSrc)
+			}
+			if got.Encoding != nil {
+				t.Errorf("Parse(Encode(%v, %q)) Encoding = %q, want nil", n, encoding, *got.Encoding)
+			}
+		}
+	}
+}
+
+func TestEncodeUnsupported(t *testing.T) {
+	jsonBlob := &IRMF{IRMFVersion: "1.0", Language: "glsl", Materials: []string{"PLA"}, Min: []float64{0, 0, 0}, Max: []float64{1, 1, 1}, Units: "mm"}
+	if _, err := jsonBlob.Encode(testShader, "bzip2"); err == nil {
+		t.Error("Encode(bzip2) = nil, want error")
+	}
+}
+
+func TestEncodeVersions(t *testing.T) {
+	tests := []struct {
+		version  string
+		encoding string
+		wantErr  string
+	}{
+		{version: "1.0", encoding: "gzip"},
+		{version: "1.0", encoding: "gzip+base64"},
+		{version: "1.0", encoding: "zlib", wantErr: `"zlib" requires IRMF 1.1`},
+		{version: "1.0", encoding: "deflate+base64", wantErr: `"deflate+base64" requires IRMF 1.1`},
+		{version: "1.0", encoding: "base64", wantErr: `"base64" requires IRMF 1.1`},
+		{version: "1.1", encoding: "zlib"},
+		{version: "1.1", encoding: "base64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version+" "+tt.encoding, func(t *testing.T) {
+			jsonBlob := &IRMF{IRMFVersion: tt.version, Language: "glsl", Materials: []string{"PLA"}, Min: []float64{0, 0, 0}, Max: []float64{1, 1, 1}, Units: "mm"}
+			buf, err := jsonBlob.Encode(testShader, tt.encoding)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Encode = %v, want nil", err)
+				}
+				if _, _, err := Parse(buf); err != nil {
+					t.Errorf("Parse(Encode) = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Encode = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseEncodings1p0(t *testing.T) {
+	// Other tools may write any supported encoding into an IRMF 1.0 file.
+	for _, encoding := range []string{"zlib", "deflate", "base64"} {
+		t.Run(encoding, func(t *testing.T) {
+			body, err := encodeBody(encoding, testShader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header := `/*{"irmf":"1.0","language":"glsl","materials":["PLA"],"max":[1,1,1],"min":[0,0,0],"units":"mm",` + "\n" + `"encoding":"` + encoding + `"` + "\n}*/\n"
+			jsonBlob, shaderSrc, err := Parse(append([]byte(header), body...))
+			if err != nil {
+				t.Fatalf("Parse = %v, want nil", err)
+			}
+			if shaderSrc != testShader || jsonBlob.Encoding != nil {
+				t.Errorf("Parse = (%v, %q), want the decoded shader", jsonBlob.Encoding, shaderSrc)
+			}
+			warnings := jsonBlob.Warnings()
+			if len(warnings) != 1 || warnings[0].Line != 2 || !strings.Contains(warnings[0].Error(), "requires IRMF 1.1") {
+				t.Errorf("Warnings = %v, want a warning on line 2 that it requires IRMF 1.1", warnings)
+			}
+		})
+	}
+}
+
+func TestDecodeBodyLimit(t *testing.T) {
+	huge := strings.Repeat(" ", MaxDecodedSize+1)
+	for _, encoding := range []string{"gzip", "zlib", "deflate+base64"} {
+		body, err := encodeBody(encoding, huge)
+		if err != nil {
+			t.Fatalf("encodeBody(%q): %v", encoding, err)
+		}
+		if _, err := decodeBody(encoding, body); err == nil || !strings.Contains(err.Error(), "exceeds") {
+			t.Errorf("decodeBody(%q) = %v, want size limit error", encoding, err)
+		}
+	}
+
+	body, err := encodeBody("gzip", huge[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeBody("gzip", body); err != nil {
+		t.Errorf("decodeBody(%v bytes) = %v, want nil", MaxDecodedSize, err)
+	}
+}
+
+func TestDecodeBodyLenientBase64(t *testing.T) {
+	// Other tools may wrap base64 output and include padding.
+	body := "Ly8gaGVs\nbG8K\n" // "// hello\n" with a line break
+	got, err := decodeBody("base64", []byte(body))
+	if err != nil {
+		t.Fatalf("decodeBody: %v", err)
+	}
+	if want := "// hello\n"; got != want {
+		t.Errorf("decodeBody = %q, want %q", got, want)
+	}
+	if got, err = decodeBody("base64", []byte("Ly8gaGk=")); err != nil || got != "// hi" {
+		t.Errorf("decodeBody(padded) = %q, %v, want %q", got, err, "// hi")
+	}
+}
+
+func FuzzEncodingRoundTrip(f *testing.F) {
+	f.Add(testShader)
+	f.Add("")
+	f.Add("\x00\xff\r\n µm")
+	f.Fuzz(func(t *testing.T, shaderSrc string) {
+		for _, encoding := range Encodings() {
+			body, err := encodeBody(encoding, shaderSrc)
+			if err != nil {
+				t.Fatalf("encodeBody(%q): %v", encoding, err)
+			}
+			got, err := decodeBody(encoding, body)
+			if err != nil {
+				t.Fatalf("decodeBody(%q): %v", encoding, err)
+			}
+			if got != shaderSrc {
+				t.Fatalf("decodeBody(encodeBody(%q)) = %q, want %q", encoding, got, shaderSrc)
+			}
+		}
+	})
+}
+
+func FuzzDecodeBody(f *testing.F) {
+	for _, encoding := range Encodings() {
+		body, err := encodeBody(encoding, testShader)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(encoding, body)
+	}
+	f.Fuzz(func(t *testing.T, encoding string, body []byte) {
+		// Arbitrary input must never panic.
+		decodeBody(encoding, body)
+	})
+}
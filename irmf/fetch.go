@@ -0,0 +1,137 @@
+package irmf
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// HTTPFetcher is a Fetcher for native tools that retrieves "http" and
+// "https" URLs from the network and "file" URLs from the local filesystem,
+// using the standard include resolution rules (see ResolveInclude).
+type HTTPFetcher struct {
+	// Client makes the requests; http.DefaultClient is used if nil.
+	Client *http.Client
+}
+
+// Resolve implements Fetcher with ResolveInclude.
+func (f HTTPFetcher) Resolve(inc, parentURL, language string) string {
+	return ResolveInclude(inc, parentURL, language)
+}
+
+// Fetch retrieves the contents of rawURL.
+func (f HTTPFetcher) Fetch(rawURL string) ([]byte, error) {
+	resp, err := f.FetchIfNoneMatch(rawURL, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// FetchIfNoneMatch retrieves the contents of rawURL along with its ETag.
+// If etag is not empty, it is sent as "If-None-Match" so that the server
+// can report that a previously fetched copy is still current.
+func (f HTTPFetcher) FetchIfNoneMatch(rawURL, etag string) (*Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "file" {
+		buf, err := os.ReadFile(filepath.FromSlash(u.Path))
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Body: buf}, nil
+	}
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && etag != "":
+		return &Response{ETag: etag, NotModified: true}, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("GET %v: %v", rawURL, resp.Status)
+	}
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Body: buf, ETag: resp.Header.Get("ETag")}, nil
+}
+
+// Response is the result of fetching a file along with its ETag.
+type Response struct {
+	Body []byte
+	// ETag identifies this version of the file, if the server provides one.
+	ETag string
+	// NotModified means that the file still matches the ETag that was
+	// asked about, so Body is empty.
+	NotModified bool
+}
+
+// ConditionalFetcher is a Fetcher that can also report the ETags of the
+// files it fetches and revalidate previously fetched copies by their ETag.
+type ConditionalFetcher interface {
+	Fetcher
+	FetchIfNoneMatch(url, etag string) (*Response, error)
+}
+
+// FetchResponse fetches url with fetcher, revalidating the copy whose ETag
+// is etag (if any) when fetcher is a ConditionalFetcher. Other fetchers
+// always return the full file without an ETag.
+func FetchResponse(fetcher Fetcher, url, etag string) (*Response, error) {
+	if cf, ok := fetcher.(ConditionalFetcher); ok {
+		return cf.FetchIfNoneMatch(url, etag)
+	}
+	buf, err := fetcher.Fetch(url)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Body: buf}, nil
+}
+
+// MemoryFetcher is a Fetcher that serves files from memory, keyed by URL,
+// using the standard include resolution rules (see ResolveInclude).
+type MemoryFetcher map[string]string
+
+// Resolve implements Fetcher with ResolveInclude.
+func (f MemoryFetcher) Resolve(inc, parentURL, language string) string {
+	return ResolveInclude(inc, parentURL, language)
+}
+
+// Fetch returns the contents of url, or fs.ErrNotExist.
+func (f MemoryFetcher) Fetch(url string) ([]byte, error) {
+	s, ok := f[url]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return []byte(s), nil
+}
+
+// FileURL returns the "file" URL of the local file filename, suitable
+// as the base URL for resolving the relative includes of the file.
+func FileURL(filename string) (string, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String(), nil
+}
@@ -0,0 +1,101 @@
+package irmf
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTTPFetcher(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/a.glsl" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("float a;"))
+	}))
+	defer ts.Close()
+
+	f := HTTPFetcher{Client: ts.Client()}
+	if got, err := f.Fetch(ts.URL + "/a.glsl"); err != nil || string(got) != "float a;" {
+		t.Errorf("Fetch(a.glsl) = (%q, %v), want float a;", got, err)
+	}
+	if _, err := f.Fetch(ts.URL + "/missing.glsl"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Fetch(missing.glsl) err = %v, want 404", err)
+	}
+	if got, want := f.Resolve("lygia/a.glsl", "", "glsl"), "https://lygia.xyz/a.glsl"; got != want {
+		t.Errorf("Resolve = %q, want %q", got, want)
+	}
+}
+
+func TestHTTPFetcherETag(t *testing.T) {
+	const etag = `"v1"`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("float a;"))
+	}))
+	defer ts.Close()
+
+	f := HTTPFetcher{Client: ts.Client()}
+	tests := []struct {
+		name    string
+		fetcher Fetcher
+		etag    string
+		want    Response
+	}{
+		{name: "first fetch", fetcher: f, want: Response{Body: []byte("float a;"), ETag: etag}},
+		{name: "not modified", fetcher: f, etag: etag, want: Response{ETag: etag, NotModified: true}},
+		{name: "modified", fetcher: f, etag: `"v0"`, want: Response{Body: []byte("float a;"), ETag: etag}},
+		{name: "through a LYGIA mirror", fetcher: LygiaMirror("file:///nonexistent", f), etag: etag, want: Response{ETag: etag, NotModified: true}},
+		{name: "without ETag support", fetcher: MemoryFetcher{ts.URL + "/a.glsl": "float b;"}, etag: etag, want: Response{Body: []byte("float b;")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FetchResponse(tt.fetcher, ts.URL+"/a.glsl", tt.etag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got.Body) != string(tt.want.Body) || got.ETag != tt.want.ETag || got.NotModified != tt.want.NotModified {
+				t.Errorf("FetchResponse = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryFetcher(t *testing.T) {
+	f := MemoryFetcher{"https://lygia.xyz/a.glsl": "float a;"}
+	if got, err := f.Fetch("https://lygia.xyz/a.glsl"); err != nil || string(got) != "float a;" {
+		t.Errorf("Fetch(a.glsl) = (%q, %v), want float a;", got, err)
+	}
+	if _, err := f.Fetch("https://lygia.xyz/b.glsl"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Fetch(b.glsl) err = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestFileURL(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "lib", "util.glsl"), []byte("float util;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	baseURL, err := FileURL(filepath.Join(dir, "model.irmf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ExpandIncludes("#include \"lib/util.glsl\"", IncludeOptions{BaseURL: baseURL}, HTTPFetcher{})
+	if err != nil || got != "float util;" {
+		t.Errorf("ExpandIncludes = (%q, %v), want float util;", got, err)
+	}
+}
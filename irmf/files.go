@@ -0,0 +1,35 @@
+package irmf
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FindFiles returns the files of paths, with directories replaced by the
+// .irmf files within them (recursively), as given on the command line of
+// the IRMF tools.
+func FindFiles(paths []string) ([]string, error) {
+	var result []string
+	for _, arg := range paths {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			result = append(result, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(name string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.EqualFold(filepath.Ext(name), ".irmf") {
+				result = append(result, name)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,35 @@
+package irmf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.irmf", "lib/b.IRMF", "lib/c.glsl", "d.txt"} {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Files are returned as given, whatever their extension.
+	got, err := FindFiles([]string{filepath.Join(dir, "d.txt"), dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "d.txt"), filepath.Join(dir, "a.irmf"), filepath.Join(dir, "lib", "b.IRMF")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindFiles = %v, want %v", got, want)
+	}
+
+	if _, err := FindFiles([]string{filepath.Join(dir, "missing.irmf")}); !os.IsNotExist(err) {
+		t.Errorf("FindFiles(missing) = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,126 @@
+package irmf
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historyKeyPrefix prefixes the keys of all History snapshots in a CacheStore.
+const historyKeyPrefix = "irmf-history:"
+
+// Snapshot is one saved version of an IRMF file.
+type Snapshot struct {
+	SavedAt time.Time `json:"savedAt"`
+	// Title is the "title" of the file's header, if any.
+	Title  string `json:"title,omitempty"`
+	Source string `json:"source"`
+}
+
+// History keeps the most recent versions of an IRMF file (such as the
+// editor buffer) in a CacheStore, along with when they were saved.
+type History struct {
+	store CacheStore
+	// MaxVersions is the number of versions kept.
+	MaxVersions int
+
+	now func() time.Time
+}
+
+// NewHistory returns a History backed by store.
+func NewHistory(store CacheStore, maxVersions int) *History {
+	return &History{store: store, MaxVersions: maxVersions, now: time.Now}
+}
+
+// historyKey returns the store key of a snapshot, which sorts by time.
+func historyKey(savedAt time.Time) string {
+	return fmt.Sprintf("%v%020d", historyKeyPrefix, savedAt.UnixNano())
+}
+
+// keys returns the store keys of all snapshots, newest first.
+func (h *History) keys() []string {
+	var result []string
+	for _, key := range h.store.Keys() {
+		if strings.HasPrefix(key, historyKeyPrefix) {
+			result = append(result, key)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(result)))
+	return result
+}
+
+func (h *History) load(key string) (*Snapshot, bool) {
+	v, ok := h.store.Get(key)
+	if !ok {
+		return nil, false
+	}
+	s := &Snapshot{}
+	if err := json.Unmarshal([]byte(v), s); err != nil {
+		h.store.Delete(key) // Corrupt; drop it.
+		return nil, false
+	}
+	return s, true
+}
+
+// Save adds src (with the given title) as the newest version, unless it
+// is identical to the newest version already. The oldest versions are
+// removed to keep at most MaxVersions, or to make room in the store.
+// It reports whether a new version was saved.
+func (h *History) Save(src, title string) (bool, error) {
+	if latest, ok := h.Latest(); ok && latest.Source == src {
+		return false, nil
+	}
+
+	s := &Snapshot{SavedAt: h.now(), Title: title, Source: src}
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return false, err
+	}
+	keys := h.keys()
+	for len(keys) >= h.MaxVersions && len(keys) > 0 {
+		h.store.Delete(keys[len(keys)-1])
+		keys = keys[:len(keys)-1]
+	}
+	for {
+		err := h.store.Set(historyKey(s.SavedAt), string(buf))
+		if err == nil {
+			return true, nil
+		}
+		if len(keys) == 0 {
+			return false, err
+		}
+		// The store itself is full (e.g. a browser quota); make more room.
+		h.store.Delete(keys[len(keys)-1])
+		keys = keys[:len(keys)-1]
+	}
+}
+
+// Versions returns all saved versions, newest first.
+func (h *History) Versions() []*Snapshot {
+	var result []*Snapshot
+	for _, key := range h.keys() {
+		if s, ok := h.load(key); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// Latest returns the newest version, if any.
+func (h *History) Latest() (*Snapshot, bool) {
+	for _, key := range h.keys() {
+		if s, ok := h.load(key); ok {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// Clear removes all versions.
+func (h *History) Clear() {
+	for _, key := range h.keys() {
+		h.store.Delete(key)
+	}
+}
@@ -0,0 +1,56 @@
+package irmf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	store := NewMemoryCacheStore()
+	h := NewHistory(store, 3)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	h.now = func() time.Time { now = now.Add(time.Minute); return now }
+
+	if _, ok := h.Latest(); ok {
+		t.Fatal("Latest of empty history = ok, want none")
+	}
+	for _, src := range []string{"v1", "v2", "v2", "v3", "v4"} {
+		if _, err := h.Save(src, "title "+src); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions := h.Versions()
+	var got []string
+	for _, v := range versions {
+		got = append(got, v.Source)
+	}
+	if want := []string{"v4", "v3", "v2"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("Versions = %v, want %v (identical versions saved once, oldest dropped)", got, want)
+	}
+	if latest, ok := h.Latest(); !ok || latest.Source != "v4" || latest.Title != "title v4" || !latest.SavedAt.Equal(now) {
+		t.Errorf("Latest = %+v, want v4 saved at %v", latest, now)
+	}
+
+	// Other users of the store are unaffected.
+	store.Set("other", "x")
+	h.Clear()
+	if len(h.Versions()) != 0 {
+		t.Errorf("Versions after Clear = %v, want none", h.Versions())
+	}
+	if _, ok := store.Get("other"); !ok {
+		t.Error("Clear removed a key that was not part of the history")
+	}
+}
+
+func TestHistoryQuota(t *testing.T) {
+	h := NewHistory(&quotaStore{MemoryCacheStore: NewMemoryCacheStore(), max: 2}, 10)
+	for _, src := range []string{"v1", "v2", "v3"} {
+		if saved, err := h.Save(src, ""); !saved || err != nil {
+			t.Fatalf("Save(%v) = (%v, %v), want saved", src, saved, err)
+		}
+	}
+	if versions := h.Versions(); len(versions) != 2 || versions[0].Source != "v3" {
+		t.Errorf("Versions = %+v, want v3 and v2", versions)
+	}
+}
@@ -0,0 +1,254 @@
+package irmf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IncludeHost maps "#include" paths starting with Prefix (e.g. "gitlab.com/"
+// or "mylib/") to the raw URLs of their files.
+type IncludeHost struct {
+	// Prefix must end with "/".
+	Prefix string `json:"prefix"`
+	// Template is the raw URL of the included file, where "{path}" is
+	// replaced by the include path after Prefix, "{N}" by its Nth
+	// (0-based) "/"-separated segment, and "{N...}" by its segments
+	// from the Nth onward. For example, the template
+	// "https://gitlab.com/{0}/{1}/-/raw/{2}/{3...}" resolves
+	// "gitlab.com/user/repo/main/lib/util.glsl".
+	Template string `json:"template"`
+}
+
+// IncludeSettings extends the standard include resolution rules (see
+// ResolveInclude) with additional hosts and limits which hosts may be
+// fetched. They may be provided by the "includeHosts" and "allowedHosts"
+// keys of the JSON header or by a settings file with the same keys.
+//
+// Since anyone can write a header, its AllowedHosts can only restrict
+// which hosts may be fetched. Only the user's own (trusted) settings can
+// allow hosts beyond DefaultAllowedHosts; see IRMF.IncludeFetcher.
+type IncludeSettings struct {
+	// Hosts take precedence over the standard rules, longest Prefix first.
+	Hosts []IncludeHost `json:"includeHosts,omitempty"`
+	// AllowedHosts lists hosts that may be fetched: the only ones (among
+	// those otherwise allowed) for a header, or additional ones for
+	// trusted settings. "*.example.com" allows all subdomains of
+	// example.com.
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
+}
+
+// DefaultAllowedHosts are the hosts that included files may be fetched
+// from without being allowed by trusted settings.
+var DefaultAllowedHosts = []string{"lygia.xyz", "raw.githubusercontent.com"}
+
+var templateRE = regexp.MustCompile(`\{(path|\d+(\.\.\.)?)\}`)
+
+// LoadIncludeSettings reads trusted IncludeSettings from the JSON settings
+// file given by the -settings flag of the IRMF tools. It has the same
+// "includeHosts" and "allowedHosts" keys as the JSON header, for example:
+//
+//	{
+//	  "includeHosts": [
+//	    {"prefix": "gitlab.com/", "template": "https://gitlab.com/{0}/{1}/-/raw/{2}/{3...}"}
+//	  ],
+//	  "allowedHosts": ["gitlab.com", "*.example.com"]
+//	}
+//
+// but unlike those of a header, its allowed hosts are trusted: included
+// files may be fetched from them in addition to DefaultAllowedHosts.
+func LoadIncludeSettings(filename string) (*IncludeSettings, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	s := &IncludeSettings{}
+	if err := json.Unmarshal(buf, s); err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %v", filename, err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return s, nil
+}
+
+// Validate checks the include hosts and allowed hosts of s.
+func (s *IncludeSettings) Validate() error {
+	if err := s.validateHosts(); err != nil {
+		return err
+	}
+	return s.validateAllowedHosts()
+}
+
+// IncludeSettings returns the include settings of the header.
+func (i *IRMF) IncludeSettings() *IncludeSettings {
+	return &IncludeSettings{Hosts: i.IncludeHosts, AllowedHosts: i.AllowedHosts}
+}
+
+// IncludeFetcher wraps fetcher with the include settings of the header of
+// a file loaded from baseURL (if any). trusted holds the user's own
+// settings (e.g. from a settings file) and may be nil.
+//
+// Includes are first resolved with the hosts of the header, then with
+// those of trusted. Only DefaultAllowedHosts, the AllowedHosts of trusted,
+// and the host of baseURL itself may be fetched, and the AllowedHosts of
+// the header may only restrict these further. Local files may only be
+// included by local files.
+func (i *IRMF) IncludeFetcher(fetcher Fetcher, baseURL string, trusted *IncludeSettings) Fetcher {
+	if trusted == nil {
+		trusted = &IncludeSettings{}
+	}
+	f := &hostFetcher{
+		Fetcher:    fetcher,
+		hosts:      append(sortedHosts(i.IncludeHosts), sortedHosts(trusted.Hosts)...),
+		allowed:    append(append([]string(nil), DefaultAllowedHosts...), trusted.AllowedHosts...),
+		restricted: i.AllowedHosts,
+	}
+	if u, err := url.Parse(baseURL); err == nil {
+		switch {
+		case u.Scheme == "file":
+			f.local = true
+		case u.Hostname() != "":
+			f.allowed = append(f.allowed, u.Hostname())
+		}
+	}
+	return f
+}
+
+// sortedHosts returns a copy of hosts, longest Prefix first.
+func sortedHosts(hosts []IncludeHost) []IncludeHost {
+	hosts = append([]IncludeHost(nil), hosts...)
+	sort.SliceStable(hosts, func(a, b int) bool { return len(hosts[a].Prefix) > len(hosts[b].Prefix) })
+	return hosts
+}
+
+// hostFetcher is the Fetcher returned by IRMF.IncludeFetcher.
+type hostFetcher struct {
+	Fetcher
+	hosts []IncludeHost
+	// allowed are the trusted hosts, and restricted (if not empty) are
+	// the only ones of them allowed by the header.
+	allowed    []string
+	restricted []string
+	// local means that local files may be fetched.
+	local bool
+}
+
+func (f *hostFetcher) Resolve(inc, parentURL, language string) string {
+	for _, h := range f.hosts {
+		if strings.HasPrefix(inc, h.Prefix) {
+			return h.resolve(inc[len(h.Prefix):])
+		}
+	}
+	return f.Fetcher.Resolve(inc, parentURL, language)
+}
+
+func (f *hostFetcher) Fetch(rawURL string) ([]byte, error) {
+	if err := f.checkAllowed(rawURL); err != nil {
+		return nil, err
+	}
+	return f.Fetcher.Fetch(rawURL)
+}
+
+// checkAllowed returns an error if rawURL may not be fetched.
+func (f *hostFetcher) checkAllowed(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "file" {
+		if !f.local {
+			return fmt.Errorf("local file %v may only be included by local files", rawURL)
+		}
+		return nil
+	}
+	host := u.Hostname()
+	if len(f.restricted) > 0 && !matchHost(f.restricted, host) {
+		return fmt.Errorf("host %q is not allowed by the header (allowed hosts: %v)", host, strings.Join(f.restricted, ", "))
+	}
+	if !matchHost(f.allowed, host) {
+		return fmt.Errorf("host %q is not trusted; add it to the allowedHosts of your include settings (trusted hosts: %v)", host, strings.Join(f.allowed, ", "))
+	}
+	return nil
+}
+
+// matchHost reports whether host is one of hosts, where "*.example.com"
+// matches all subdomains of example.com.
+func matchHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if host == h || (strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the raw URL of path (the include path after h.Prefix),
+// or "" if path does not fit h.Template.
+func (h IncludeHost) resolve(path string) string {
+	segments := strings.Split(path, "/")
+	for _, s := range segments {
+		if s == "" || s == "." || s == ".." {
+			return ""
+		}
+	}
+
+	ok := true
+	result := templateRE.ReplaceAllStringFunc(h.Template, func(p string) string {
+		name := p[1 : len(p)-1]
+		if name == "path" {
+			return path
+		}
+		rest := strings.HasSuffix(name, "...")
+		n, _ := strconv.Atoi(strings.TrimSuffix(name, "..."))
+		switch {
+		case n >= len(segments):
+			ok = false
+			return ""
+		case rest:
+			return strings.Join(segments[n:], "/")
+		}
+		return segments[n]
+	})
+	if !ok {
+		return ""
+	}
+	return result
+}
+
+// validateHosts checks the include hosts of s.
+func (s *IncludeSettings) validateHosts() error {
+	seen := map[string]bool{}
+	for n, h := range s.Hosts {
+		if !strings.HasSuffix(h.Prefix, "/") {
+			return fmt.Errorf("includeHosts[%v]: 'prefix' must end with '/'", n)
+		}
+		if seen[h.Prefix] {
+			return fmt.Errorf("includeHosts[%v]: duplicate prefix %q", n, h.Prefix)
+		}
+		seen[h.Prefix] = true
+		u, err := url.Parse(templateRE.ReplaceAllString(h.Template, "x"))
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("includeHosts[%v]: 'template' must be an http or https URL", n)
+		}
+		if !templateRE.MatchString(h.Template) {
+			return fmt.Errorf("includeHosts[%v]: 'template' must contain {path}, {N}, or {N...}", n)
+		}
+	}
+	return nil
+}
+
+// validateAllowedHosts checks the allowed hosts of s.
+func (s *IncludeSettings) validateAllowedHosts() error {
+	for n, a := range s.AllowedHosts {
+		if a == "" || strings.ContainsAny(a, ":/") || strings.Contains(strings.TrimPrefix(a, "*."), "*") {
+			return fmt.Errorf("allowedHosts[%v]: %q must be a host name such as \"example.com\" or \"*.example.com\"", n, a)
+		}
+	}
+	return nil
+}
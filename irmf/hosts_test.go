@@ -0,0 +1,208 @@
+package irmf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncludeFetcher(t *testing.T) {
+	trusted := &IncludeSettings{
+		Hosts: []IncludeHost{
+			{Prefix: "gitlab.com/", Template: "https://gitlab.com/{0}/{1}/-/raw/{2}/{3...}"},
+			{Prefix: "gist.github.com/", Template: "https://gist.githubusercontent.com/{0}/{1}/raw/{2...}"},
+			{Prefix: "mylib/", Template: "https://git.example.com/team/mylib/raw/branch/main/{path}"},
+			{Prefix: "other/", Template: "https://other.org/{path}"},
+		},
+		AllowedHosts: []string{"gitlab.com", "gist.githubusercontent.com", "*.example.com"},
+	}
+	files := MemoryFetcher{
+		"https://gitlab.com/user/repo/-/raw/main/lib/util.glsl":          "#include \"../math.glsl\"\nfloat util;",
+		"https://gitlab.com/user/repo/-/raw/main/math.glsl":              "float math;",
+		"https://gist.githubusercontent.com/user/abc123/raw/noise.glsl":  "float noise;",
+		"https://git.example.com/team/mylib/raw/branch/main/sdf/ab.glsl": "float ab;",
+		"https://lygia.xyz/math/const.glsl":                              "float PI;",
+		"https://raw.githubusercontent.com/user/repo/main/a.glsl":        "float a;",
+		"https://other.org/b.glsl":                                       "float b;",
+		"https://models.example.org/lib/c.glsl":                          "float c;",
+		"file:///home/user/lib/d.glsl":                                   "float d;",
+	}
+
+	tests := []struct {
+		name    string
+		baseURL string
+		trusted *IncludeSettings
+		source  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "gitlab with a relative include",
+			trusted: trusted,
+			source:  "#include \"gitlab.com/user/repo/main/lib/util.glsl\"",
+			want:    "float math;\nfloat util;",
+		},
+		{
+			name:    "gist",
+			trusted: trusted,
+			source:  "#include \"gist.github.com/user/abc123/noise.glsl\"",
+			want:    "float noise;",
+		},
+		{
+			name:    "library prefix on a trusted subdomain",
+			trusted: trusted,
+			source:  "#include \"mylib/sdf/ab.glsl\"",
+			want:    "float ab;",
+		},
+		{
+			name:   "lygia is allowed by default",
+			source: "#include \"lygia/math/const.glsl\"",
+			want:   "float PI;",
+		},
+		{
+			name:   "github is allowed by default",
+			source: "#include \"github.com/user/repo/blob/main/a.glsl\"",
+			want:   "float a;",
+		},
+		{
+			name:    "the host of the file itself is allowed",
+			baseURL: "https://models.example.org/model.irmf",
+			source:  "#include \"lib/c.glsl\"",
+			want:    "float c;",
+		},
+		{
+			name:    "local files may include local files",
+			baseURL: "file:///home/user/model.irmf",
+			source:  "#include \"lib/d.glsl\"",
+			want:    "float d;",
+		},
+		{
+			name:    "path does not fit the template",
+			trusted: trusted,
+			source:  "#include \"gitlab.com/user/repo.glsl\"",
+			wantErr: `line 1: unrecognized include "gitlab.com/user/repo.glsl"`,
+		},
+		{
+			name:    "path may not escape the template",
+			trusted: trusted,
+			source:  "#include \"mylib/../secret.glsl\"",
+			wantErr: `line 1: unrecognized include "mylib/../secret.glsl"`,
+		},
+		{
+			name:    "host not trusted",
+			trusted: trusted,
+			source:  "#include \"other/b.glsl\"",
+			wantErr: `line 1: unable to include https://other.org/b.glsl: host "other.org" is not trusted`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := (&IRMF{}).IncludeFetcher(files, tt.baseURL, tt.trusted)
+			got, err := ExpandIncludes(tt.source, IncludeOptions{BaseURL: tt.baseURL}, fetcher)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("ExpandIncludes err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExpandIncludes: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExpandIncludes =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncludeFetcherLocalFiles(t *testing.T) {
+	files := MemoryFetcher{"file:///etc/passwd.glsl": "float secret;"}
+	for _, baseURL := range []string{"", "https://example.com/model.irmf"} {
+		fetcher := (&IRMF{}).IncludeFetcher(files, baseURL, nil)
+		if _, err := fetcher.Fetch("file:///etc/passwd.glsl"); err == nil || !strings.Contains(err.Error(), "may only be included by local files") {
+			t.Errorf("Fetch with baseURL %q err = %v, want local file error", baseURL, err)
+		}
+	}
+}
+
+func TestHeaderIncludeSettings(t *testing.T) {
+	// A header may add hosts and restrict the trusted hosts, but cannot widen them.
+	jsonBlob, err := ParseJSON(`{"includeHosts":[{"prefix":"lygia/","template":"https://mirror.example.com/lygia/{path}"},{"prefix":"mine/","template":"https://lygia.xyz/{path}"},{"prefix":"gh/","template":"https://raw.githubusercontent.com/{path}"}],"allowedHosts":["lygia.xyz","mirror.example.com"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := jsonBlob.IncludeFetcher(MemoryFetcher{
+		"https://mirror.example.com/lygia/a.glsl":    "float mirror;",
+		"https://lygia.xyz/b.glsl":                   "float b;",
+		"https://raw.githubusercontent.com/c/d.glsl": "float c;",
+	}, "", nil)
+
+	if got, err := ExpandIncludes(`#include "mine/b.glsl"`, IncludeOptions{}, fetcher); err != nil || got != "float b;" {
+		t.Errorf("mine/b.glsl = (%q, %v), want float b;", got, err)
+	}
+	if _, err := ExpandIncludes(`#include "lygia/a.glsl"`, IncludeOptions{}, fetcher); err == nil || !strings.Contains(err.Error(), `host "mirror.example.com" is not trusted`) {
+		t.Errorf("lygia/a.glsl err = %v, want mirror.example.com not trusted", err)
+	}
+	if _, err := ExpandIncludes(`#include "gh/c/d.glsl"`, IncludeOptions{}, fetcher); err == nil || !strings.Contains(err.Error(), `host "raw.githubusercontent.com" is not allowed by the header`) {
+		t.Errorf("gh/c/d.glsl err = %v, want raw.githubusercontent.com not allowed by the header", err)
+	}
+}
+
+func TestValidateIncludeSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		wantErr string
+	}{
+		{name: "valid", header: `"includeHosts":[{"prefix":"mylib/","template":"https://example.com/{path}"}],"allowedHosts":["example.com","*.example.com"]`},
+		{name: "prefix without slash", header: `"includeHosts":[{"prefix":"mylib","template":"https://example.com/{path}"}]`, wantErr: "must end with '/'"},
+		{name: "duplicate prefix", header: `"includeHosts":[{"prefix":"a/","template":"https://example.com/{path}"},{"prefix":"a/","template":"https://example.com/{path}"}]`, wantErr: "duplicate prefix"},
+		{name: "not a URL", header: `"includeHosts":[{"prefix":"a/","template":"example.com/{path}"}]`, wantErr: "must be an http or https URL"},
+		{name: "no placeholder", header: `"includeHosts":[{"prefix":"a/","template":"https://example.com/a.glsl"}]`, wantErr: "must contain {path}"},
+		{name: "bad allowed host", header: `"allowedHosts":["https://example.com"]`, wantErr: "must be a host name"},
+		{name: "bad wildcard", header: `"allowedHosts":["*"]`, wantErr: "must be a host name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonBlobStr := `{"irmf":"1.1","language":"glsl","materials":["PLA"],"max":[1,1,1],"min":[0,0,0],"units":"mm",` + tt.header + `}`
+			jsonBlob, err := ParseJSON(jsonBlobStr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = jsonBlob.Validate(jsonBlobStr, testShader)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadIncludeSettings(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(filename, []byte(`{"includeHosts":[{"prefix":"mylib/","template":"https://example.com/{path}"}],"allowedHosts":["example.com"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadIncludeSettings(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := (&IRMF{}).IncludeFetcher(MemoryFetcher{}, "", s).Resolve("mylib/a.glsl", "", "glsl"), "https://example.com/a.glsl"; got != want {
+		t.Errorf("Resolve = %q, want %q", got, want)
+	}
+
+	if err := os.WriteFile(filename, []byte(`{"allowedHosts":["http://example.com"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIncludeSettings(filename); err == nil || !strings.Contains(err.Error(), "allowedHosts[0]") {
+		t.Errorf("LoadIncludeSettings err = %v, want allowedHosts[0] error", err)
+	}
+}
@@ -0,0 +1,374 @@
+package irmf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// GitHubRawPrefix is where raw GitHub file contents are served from.
+	GitHubRawPrefix = "https://raw.githubusercontent.com/"
+
+	lygiaBaseURL = "https://lygia.xyz"
+	prefix1      = "lygia.xyz/"
+	prefix2      = "lygia/"
+	prefix3      = "github.com/"
+
+	// MaxIncludeDepth limits how deeply "#include" files may be nested.
+	MaxIncludeDepth = 32
+)
+
+var (
+	includeRE = regexp.MustCompile(`^#include\s+"([^"]+)"`)
+	pragmaRE  = regexp.MustCompile(`(?m)^[ \t]*#[ \t]*pragma[ \t]+once\b.*$`)
+	guardRE   = regexp.MustCompile(`^\s*#[ \t]*ifndef[ \t]+(\w+)[ \t]*\n\s*#[ \t]*define[ \t]+(\w+)\b`)
+	endifRE   = regexp.MustCompile(`#[ \t]*endif\b[^\n]*\s*$`)
+)
+
+// includeExtensions maps each shader language to the file extension
+// of the files it may include.
+var includeExtensions = map[string]string{
+	"glsl": ".glsl",
+	"wgsl": ".wgsl",
+}
+
+// Fetcher resolves "#include" paths to URLs and retrieves their contents.
+type Fetcher interface {
+	// Resolve returns the URL of the include path inc (the quoted part of
+	// an "#include" line) within a file of the given language loaded from
+	// parentURL (which may be empty), or "" if inc is not recognized.
+	Resolve(inc, parentURL, language string) string
+	// Fetch retrieves the contents of url.
+	Fetch(url string) ([]byte, error)
+}
+
+// FetchFunc retrieves the contents of url. It is a Fetcher that uses
+// the standard include resolution rules (see ResolveInclude).
+type FetchFunc func(url string) ([]byte, error)
+
+// Resolve implements Fetcher with ResolveInclude.
+func (f FetchFunc) Resolve(inc, parentURL, language string) string {
+	return ResolveInclude(inc, parentURL, language)
+}
+
+// Fetch implements Fetcher by calling f.
+func (f FetchFunc) Fetch(url string) ([]byte, error) {
+	return f(url)
+}
+
+// wrappedFetcher resolves includes with its Fetcher, but retrieves them with fetch.
+type wrappedFetcher struct {
+	Fetcher
+	fetch FetchFunc
+}
+
+func (w wrappedFetcher) Fetch(url string) ([]byte, error) {
+	return w.fetch(url)
+}
+
+// IncludeOptions controls how "#include" lines are resolved.
+type IncludeOptions struct {
+	// BaseURL is the URL that the top-level source was loaded from, if any.
+	// Relative includes in the top-level source are resolved against it.
+	BaseURL string
+	// Language is the language of the shader: "glsl" (the default) or "wgsl".
+	// All included files must be written in the same language.
+	Language string
+	// Inline produces a standalone shader: each inlined file is annotated
+	// with its origin URL, "#include" lines that are not live are commented
+	// out, and live includes that cannot be inlined are errors.
+	Inline bool
+}
+
+func (o IncludeOptions) language() string {
+	if o.Language == "" {
+		return "glsl"
+	}
+	return o.Language
+}
+
+// ParseIncludeURL returns the URL of a recognized "#include" line
+// (which must already be trimmed) of a GLSL shader, or "" if the line
+// is not a recognized include.
+func ParseIncludeURL(trimmed string) string {
+	return parseIncludeURL(trimmed, "", "glsl")
+}
+
+// parseIncludeURL is like ParseIncludeURL, but also resolves relative
+// include paths against parentURL (see ResolveInclude).
+func parseIncludeURL(trimmed, parentURL, language string) string {
+	m := includeRE.FindStringSubmatch(trimmed)
+	if len(m) < 2 {
+		return ""
+	}
+	return ResolveInclude(m[1], parentURL, language)
+}
+
+// ResolveInclude returns the URL of the include path inc (the quoted part
+// of an "#include" line), or "" if inc is not recognized. These are the
+// standard include resolution rules: "lygia/" and "lygia.xyz/" paths are
+// served by LYGIA, "github.com/" paths by raw GitHub, and relative paths
+// are resolved against parentURL (when non-empty). For WGSL shaders,
+// LYGIA's WGSL variants of ".glsl" includes are used.
+func ResolveInclude(inc, parentURL, language string) string {
+	if !strings.HasSuffix(inc, ".glsl") && !strings.HasSuffix(inc, ".wgsl") {
+		return ""
+	}
+
+	var result string
+	switch {
+	case strings.HasPrefix(inc, prefix1):
+		result = fmt.Sprintf("%v/%v", lygiaBaseURL, inc[len(prefix1):])
+	case strings.HasPrefix(inc, prefix2):
+		result = fmt.Sprintf("%v/%v", lygiaBaseURL, inc[len(prefix2):])
+	case strings.HasPrefix(inc, prefix3):
+		location := inc[len(prefix3):]
+		location = strings.Replace(location, "/blob/", "/", 1)
+		result = GitHubRawPrefix + location
+	case parentURL != "":
+		result = resolveRelative(parentURL, inc)
+	}
+
+	if language == "wgsl" && strings.HasPrefix(result, lygiaBaseURL+"/") && strings.HasSuffix(result, ".glsl") {
+		result = strings.TrimSuffix(result, ".glsl") + ".wgsl"
+	}
+	return result
+}
+
+// resolveRelative resolves the relative path inc against parentURL.
+// Files within a GitHub repository may not refer outside of it.
+func resolveRelative(parentURL, inc string) string {
+	base, err := url.Parse(parentURL)
+	if err != nil {
+		return ""
+	}
+	ref, err := url.Parse(inc)
+	if err != nil || ref.IsAbs() || ref.Host != "" {
+		return ""
+	}
+	result := base.ResolveReference(ref).String()
+	if root := gitHubRepoRoot(parentURL); root != "" && !strings.HasPrefix(result, root) {
+		return ""
+	}
+	return result
+}
+
+// gitHubRepoRoot returns the raw URL of the root of the repository
+// (at the same ref) that rawURL belongs to, or "" if rawURL is not
+// a raw GitHub URL.
+func gitHubRepoRoot(rawURL string) string {
+	if !strings.HasPrefix(rawURL, GitHubRawPrefix) {
+		return ""
+	}
+	parts := strings.SplitN(rawURL[len(GitHubRawPrefix):], "/", 4) // user, repo, ref, path
+	if len(parts) < 4 {
+		return ""
+	}
+	return GitHubRawPrefix + strings.Join(parts[:3], "/") + "/"
+}
+
+// isIncludeOnce reports whether src is protected against multiple inclusion,
+// either by "#pragma once" or by a classic "#ifndef X / #define X ... #endif"
+// include guard.
+func isIncludeOnce(src string) bool {
+	src = stripComments(src)
+	if pragmaRE.MatchString(src) {
+		return true
+	}
+	m := guardRE.FindStringSubmatch(src)
+	return len(m) == 3 && m[1] == m[2] && endifRE.MatchString(src)
+}
+
+// includeExpander holds the state of one recursive include expansion.
+type includeExpander struct {
+	opts    IncludeOptions
+	fetcher Fetcher
+	pp      *preprocessor
+	visited map[string]bool
+	stack   []string
+	errs    IncludeErrors
+}
+
+// IncludeErrors lists the problems found with "#include" lines, each
+// reported on the line of the top-level source responsible for it.
+type IncludeErrors []*LineError
+
+func (e IncludeErrors) Error() string {
+	var msgs []string
+	for _, err := range e {
+		msgs = append(msgs, fmt.Sprintf("line %v: %v", err.Line, err.Err))
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e IncludeErrors) Unwrap() []error {
+	var result []error
+	for _, err := range e {
+		result = append(result, err)
+	}
+	return result
+}
+
+// ExpandIncludes converts "#include" lines (with recognized prefixes)
+// into their actual source, resolving and retrieving them with fetcher.
+// Includes within included files are expanded recursively, where
+// relative paths are resolved against the including file's URL.
+// Each file is included at most once; a file that includes one of its
+// own includers is reported as a cycle unless it is protected by
+// "#pragma once" or an include guard.
+// Relative includes (e.g. "lib/util.glsl" or "../util.glsl") in source
+// itself are resolved against opts.BaseURL.
+// Included files must be written in opts.Language, as indicated by their
+// ".glsl" or ".wgsl" extension.
+// Comments and preprocessor conditionals ("#if", "#ifdef", "#ifndef",
+// "#elif", "#else", with "#define" and "#undef") are honored, so that
+// "#include" lines within "/* */" comments or inactive groups are left
+// untouched and never fetched.
+// Live includes that cannot be resolved, fetched, or expanded are all
+// reported in the returned IncludeErrors.
+func ExpandIncludes(source string, opts IncludeOptions, fetcher Fetcher) (string, error) {
+	result, _, err := ExpandIncludesWithMap(source, opts, fetcher)
+	return result, err
+}
+
+// ExpandIncludesWithMap is like ExpandIncludes, but also returns a SourceMap
+// that maps each line of the expanded result back to its original file and line.
+func ExpandIncludesWithMap(source string, opts IncludeOptions, fetcher Fetcher) (string, SourceMap, error) {
+	e := &includeExpander{opts: opts, fetcher: fetcher, pp: newPreprocessor(opts.language()), visited: map[string]bool{}}
+	lines, sourceMap := e.expand(source, opts.BaseURL, 0)
+	if len(e.errs) > 0 {
+		return "", nil, e.errs
+	}
+	return strings.Join(lines, "\n"), sourceMap, nil
+}
+
+// expand returns the expanded lines of source (from parentURL) and their
+// origins. rootLine is the line of the top-level source responsible for
+// including source (0 for the top-level source itself, in which case
+// parentURL is its base URL).
+func (e *includeExpander) expand(source, parentURL string, rootLine int) ([]string, SourceMap) {
+	lines := strings.Split(source, "\n")
+	var result []string
+	var sourceMap SourceMap
+	for i, line := range lines {
+		origin := SourceLine{URL: parentURL, Line: i + 1, RootLine: rootLine}
+		if rootLine == 0 {
+			origin = SourceLine{Line: i + 1, RootLine: i + 1}
+		}
+
+		code := e.pp.line(line)
+		if rootLine != 0 && pragmaRE.MatchString(code) {
+			continue // "#pragma once" has already been handled.
+		}
+		var url string
+		if m := includeRE.FindStringSubmatch(code); m != nil {
+			if url = e.fetcher.Resolve(m[1], parentURL, e.opts.language()); url == "" {
+				e.fail(origin, fmt.Errorf("unrecognized include %q: %v", m[1], e.unrecognizedReason(m[1], parentURL)))
+				continue
+			}
+		}
+		if url == "" {
+			if e.opts.Inline && code == "" && includeRE.MatchString(strings.TrimSpace(line)) {
+				line = "// " + line // Not live, but make sure nothing tries to include it.
+			}
+			result = append(result, line)
+			sourceMap = append(sourceMap, origin)
+			continue
+		}
+		if ext := includeExtensions[e.opts.language()]; !strings.HasSuffix(url, ext) {
+			e.fail(origin, fmt.Errorf("cannot include %v in a %v shader (only %q files are allowed)", url, strings.ToUpper(e.opts.language()), ext))
+			continue
+		}
+
+		if e.visited[url] {
+			if e.onStack(url) {
+				buf, err := e.fetcher.Fetch(url)
+				if err != nil || !isIncludeOnce(string(buf)) {
+					e.fail(origin, fmt.Errorf("include cycle: %v", e.chain(url)))
+				}
+			}
+			continue // Already included.
+		}
+		if len(e.stack) >= MaxIncludeDepth {
+			e.fail(origin, fmt.Errorf("includes nested more than %v deep: %v", MaxIncludeDepth, e.chain(url)))
+			continue
+		}
+
+		buf, err := e.fetcher.Fetch(url)
+		if err == nil {
+			err = checkIncludeContent(buf)
+		}
+		if err != nil {
+			e.fail(origin, fmt.Errorf("unable to include %v: %w", url, err))
+			continue
+		}
+		e.visited[url] = true
+		e.stack = append(e.stack, url)
+		expanded, expandedMap := e.expand(string(buf), url, origin.RootLine)
+		e.stack = e.stack[:len(e.stack)-1]
+		if e.opts.Inline {
+			annotation := SourceLine{URL: url, RootLine: origin.RootLine}
+			result = append(result, "// Inlined from "+url)
+			sourceMap = append(sourceMap, annotation)
+			expanded = append(expanded, "// End of "+url)
+			expandedMap = append(expandedMap, annotation)
+		}
+		result = append(result, expanded...)
+		sourceMap = append(sourceMap, expandedMap...)
+	}
+
+	return result, sourceMap
+}
+
+// fail records a problem with the "#include" at origin. Problems within
+// included files are reported on the top-level "#include" responsible,
+// prefixed with their actual location.
+func (e *includeExpander) fail(origin SourceLine, err error) {
+	if origin.URL != "" {
+		err = fmt.Errorf("%v:%v: %w", origin.URL, origin.Line, err)
+	}
+	e.errs = append(e.errs, &LineError{Line: origin.RootLine, Err: err})
+}
+
+// unrecognizedReason explains why the include path inc could not be resolved.
+func (e *includeExpander) unrecognizedReason(inc, parentURL string) string {
+	switch {
+	case !strings.HasSuffix(inc, ".glsl") && !strings.HasSuffix(inc, ".wgsl"):
+		return `included files must end with ".glsl" or ".wgsl"`
+	case parentURL == "":
+		return fmt.Sprintf("use a %q, %q, or %q prefix, or load the shader from a URL to use relative paths", prefix2, prefix1, prefix3)
+	default:
+		return fmt.Sprintf("it is not a valid path relative to %v", parentURL)
+	}
+}
+
+// checkIncludeContent reports content that is clearly not shader source,
+// such as an HTML error page.
+func checkIncludeContent(buf []byte) error {
+	if !utf8.Valid(buf) || bytes.IndexByte(buf, 0) >= 0 {
+		return errors.New("response is not text")
+	}
+	if trimmed := bytes.TrimSpace(buf); bytes.HasPrefix(trimmed, []byte("<")) {
+		return errors.New("response is HTML, not shader source")
+	}
+	return nil
+}
+
+func (e *includeExpander) onStack(url string) bool {
+	for _, s := range e.stack {
+		if s == url {
+			return true
+		}
+	}
+	return false
+}
+
+// chain returns the include chain leading to url, for error messages.
+func (e *includeExpander) chain(url string) string {
+	return strings.Join(append(append([]string{}, e.stack...), url), " -> ")
+}
@@ -0,0 +1,257 @@
+package irmf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseIncludeURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		trimmed string
+		want    string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:    "bogus",
+			trimmed: `#include "bad/include.h"`,
+		},
+		{
+			name:    "lygia normal",
+			trimmed: `#include "lygia/math/decimation.glsl"`,
+			want:    "https://lygia.xyz/math/decimation.glsl",
+		},
+		{
+			name:    "lygia extra space",
+			trimmed: `#include    "lygia/math/decimation.glsl"`,
+			want:    "https://lygia.xyz/math/decimation.glsl",
+		},
+		{
+			name:    "lygia accidental copy/paste",
+			trimmed: `#include "lygia.xyz/math/decimation.glsl"`,
+			want:    "https://lygia.xyz/math/decimation.glsl",
+		},
+		{
+			name:    "github normal",
+			trimmed: `#include "github.com/gmlewis/irmf-examples/blob/master/examples/012-bifilar-electromagnet/rotation.glsl"`,
+			want:    "https://raw.githubusercontent.com/gmlewis/irmf-examples/master/examples/012-bifilar-electromagnet/rotation.glsl",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseIncludeURL(tt.trimmed)
+			if got != tt.want {
+				t.Errorf("ParseIncludeURL got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandIncludes(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		baseURL  string
+		language string
+		files    map[string]string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:   "no includes",
+			source: "float x;\nfloat y;",
+			want:   "float x;\nfloat y;",
+		},
+		{
+			name:   "nested relative include",
+			source: "#include \"lygia/math/a.glsl\"\nvoid main() {}",
+			files: map[string]string{
+				"https://lygia.xyz/math/a.glsl":  "#include \"../space/b.glsl\"\nfloat a;",
+				"https://lygia.xyz/space/b.glsl": "#include \"./c.glsl\"\nfloat b;",
+				"https://lygia.xyz/space/c.glsl": "float c;",
+			},
+			want: "float c;\nfloat b;\nfloat a;\nvoid main() {}",
+		},
+		{
+			name:    "relative to loaded GitHub file",
+			source:  "#include \"lib/util.glsl\"\n#include \"./local.glsl\"\n#include \"../shared.glsl\"",
+			baseURL: "https://raw.githubusercontent.com/user/repo/main/models/foo.irmf",
+			files: map[string]string{
+				"https://raw.githubusercontent.com/user/repo/main/models/lib/util.glsl": "#include \"../local.glsl\"\nfloat util;",
+				"https://raw.githubusercontent.com/user/repo/main/models/local.glsl":    "float local;",
+				"https://raw.githubusercontent.com/user/repo/main/shared.glsl":          "float shared;",
+			},
+			want: "float local;\nfloat util;\nfloat shared;",
+		},
+		{
+			name:    "relative include may not leave the GitHub repo",
+			source:  "#include \"../../../other/repo/main/x.glsl\"",
+			baseURL: "https://raw.githubusercontent.com/user/repo/main/foo.irmf",
+			files: map[string]string{
+				"https://raw.githubusercontent.com/other/repo/main/x.glsl": "float x;",
+			},
+			wantErr: "line 1: unrecognized include \"../../../other/repo/main/x.glsl\": it is not a valid path relative to https://raw.githubusercontent.com/user/repo/main/foo.irmf",
+		},
+		{
+			name:    "relative include without base URL",
+			source:  "#include \"lib/util.glsl\"",
+			wantErr: "line 1: unrecognized include \"lib/util.glsl\": use a \"lygia/\"",
+		},
+		{
+			name:    "unsupported extension",
+			source:  "float x;\n#include \"lygia/math/const.h\"",
+			wantErr: "line 2: unrecognized include \"lygia/math/const.h\": included files must end with \".glsl\" or \".wgsl\"",
+		},
+		{
+			name:    "fetch failure",
+			source:  "float x;\n\n#include \"lygia/missing.glsl\"",
+			wantErr: "line 3: unable to include https://lygia.xyz/missing.glsl: file does not exist",
+		},
+		{
+			name:   "nested failure is reported on the top-level include",
+			source: "float x;\n#include \"lygia/a.glsl\"",
+			files: map[string]string{
+				"https://lygia.xyz/a.glsl": "float a;\n#include \"missing.glsl\"",
+			},
+			wantErr: "line 2: https://lygia.xyz/a.glsl:2: unable to include https://lygia.xyz/missing.glsl: file does not exist",
+		},
+		{
+			name:   "html response",
+			source: "#include \"lygia/a.glsl\"",
+			files: map[string]string{
+				"https://lygia.xyz/a.glsl": "  <!DOCTYPE html>\n<html></html>",
+			},
+			wantErr: "line 1: unable to include https://lygia.xyz/a.glsl: response is HTML, not shader source",
+		},
+		{
+			name:   "binary response",
+			source: "#include \"lygia/a.glsl\"",
+			files: map[string]string{
+				"https://lygia.xyz/a.glsl": "\x1f\x8b\x00\x00",
+			},
+			wantErr: "line 1: unable to include https://lygia.xyz/a.glsl: response is not text",
+		},
+		{
+			name:     "wgsl uses lygia wgsl variants",
+			source:   "#include \"lygia/math/const.glsl\"\n#include \"lygia/space/scale.wgsl\"",
+			language: "wgsl",
+			files: map[string]string{
+				"https://lygia.xyz/math/const.wgsl":  "const PI: f32 = 3.14159;",
+				"https://lygia.xyz/space/scale.wgsl": "#include \"../math/const.wgsl\"\nfn scale() {}",
+			},
+			want: "const PI: f32 = 3.14159;\nfn scale() {}",
+		},
+		{
+			name:     "wgsl from github",
+			source:   "#include \"github.com/user/repo/blob/main/lib/sdf.wgsl\"",
+			language: "wgsl",
+			files: map[string]string{
+				"https://raw.githubusercontent.com/user/repo/main/lib/sdf.wgsl": "fn sdf() {}",
+			},
+			want: "fn sdf() {}",
+		},
+		{
+			name:     "glsl include in wgsl shader",
+			source:   "#include \"github.com/user/repo/blob/main/lib/sdf.glsl\"",
+			language: "wgsl",
+			wantErr:  "cannot include https://raw.githubusercontent.com/user/repo/main/lib/sdf.glsl in a WGSL shader",
+		},
+		{
+			name:   "wgsl include in glsl shader",
+			source: "#include \"lygia/math/const.glsl\"",
+			files: map[string]string{
+				"https://lygia.xyz/math/const.glsl": "#include \"const.wgsl\"",
+			},
+			wantErr: "cannot include https://lygia.xyz/math/const.wgsl in a GLSL shader",
+		},
+		{
+			name:   "shared dependency is only included once",
+			source: "#include \"lygia/a.glsl\"\n#include \"lygia/b.glsl\"",
+			files: map[string]string{
+				"https://lygia.xyz/a.glsl":      "#include \"common.glsl\"\nfloat a;",
+				"https://lygia.xyz/b.glsl":      "#include \"common.glsl\"\nfloat b;",
+				"https://lygia.xyz/common.glsl": "float common;",
+			},
+			want: "float common;\nfloat a;\nfloat b;",
+		},
+		{
+			name:   "pragma once is removed",
+			source: "#include \"lygia/a.glsl\"",
+			files: map[string]string{
+				"https://lygia.xyz/a.glsl": "#pragma once\nfloat a;",
+			},
+			want: "float a;",
+		},
+		{
+			name:   "cycle with include guards is allowed",
+			source: "#include \"lygia/a.glsl\"",
+			files: map[string]string{
+				"https://lygia.xyz/a.glsl": "#ifndef FNC_A\n#define FNC_A\n#include \"b.glsl\"\nfloat a;\n#endif",
+				"https://lygia.xyz/b.glsl": "#ifndef FNC_B\n#define FNC_B\n#include \"a.glsl\"\nfloat b;\n#endif\n",
+			},
+			want: "#ifndef FNC_A\n#define FNC_A\n#ifndef FNC_B\n#define FNC_B\nfloat b;\n#endif\n\nfloat a;\n#endif",
+		},
+		{
+			name:   "cycle without guards is an error",
+			source: "#include \"lygia/a.glsl\"",
+			files: map[string]string{
+				"https://lygia.xyz/a.glsl": "#include \"b.glsl\"\nfloat a;",
+				"https://lygia.xyz/b.glsl": "#include \"a.glsl\"\nfloat b;",
+			},
+			wantErr: "include cycle: https://lygia.xyz/a.glsl -> https://lygia.xyz/b.glsl -> https://lygia.xyz/a.glsl",
+		},
+		{
+			name:   "depth limit",
+			source: "#include \"lygia/0.glsl\"",
+			files: func() map[string]string {
+				files := map[string]string{}
+				for i := 0; i <= MaxIncludeDepth; i++ {
+					files[fmt.Sprintf("https://lygia.xyz/%v.glsl", i)] = fmt.Sprintf("#include \"%v.glsl\"", i+1)
+				}
+				return files
+			}(),
+			wantErr: fmt.Sprintf("includes nested more than %v deep", MaxIncludeDepth),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandIncludes(tt.source, IncludeOptions{BaseURL: tt.baseURL, Language: tt.language}, MemoryFetcher(tt.files))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ExpandIncludes err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExpandIncludes: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExpandIncludes =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	source := "#include \"lygia/a.glsl\"\n#include \"lygia/b.glsl\"\n#include \"lygia/c.glsl\""
+	files := map[string]string{"https://lygia.xyz/b.glsl": "float b;"}
+	_, err := ExpandIncludes(source, IncludeOptions{}, MemoryFetcher(files))
+
+	var includeErrs IncludeErrors
+	if !errors.As(err, &includeErrs) {
+		t.Fatalf("ExpandIncludes err = %v, want IncludeErrors", err)
+	}
+	var lines []int
+	for _, lineErr := range includeErrs {
+		lines = append(lines, lineErr.Line)
+	}
+	if fmt.Sprint(lines) != "[1 3]" {
+		t.Errorf("IncludeErrors lines = %v, want [1 3]", lines)
+	}
+}
@@ -0,0 +1,37 @@
+package irmf
+
+import "fmt"
+
+// InlineFile returns a standalone version of the IRMF file src with all
+// of its includes inlined (see IncludeOptions.Inline) so that it can be
+// used without network access. Included files are verified against the
+// header's include lock, which is then removed. baseURL is the URL that
+// src was loaded from, if any, and trusted holds the user's own include
+// settings, if any (see IRMF.IncludeFetcher). An encoded shader body is
+// decoded.
+func InlineFile(src []byte, baseURL string, fetcher Fetcher, trusted *IncludeSettings) (string, error) {
+	jsonBlob, shaderSrc, err := Parse(src)
+	if err != nil {
+		return "", err
+	}
+
+	shaderSrc, err = jsonBlob.InlineIncludes(shaderSrc, baseURL, fetcher, trusted)
+	if err != nil {
+		return "", err
+	}
+	return jsonBlob.Format(shaderSrc)
+}
+
+// InlineIncludes inlines all the includes of shaderSrc (resolved with the
+// header's include settings, see IncludeFetcher), verifying them against
+// the header's include lock. Since the result has no includes, the lock is
+// removed from the header.
+func (i *IRMF) InlineIncludes(shaderSrc, baseURL string, fetcher Fetcher, trusted *IncludeSettings) (string, error) {
+	opts := IncludeOptions{BaseURL: baseURL, Language: i.Language, Inline: true}
+	result, err := ExpandIncludes(shaderSrc, opts, i.VerifyingFetcher(i.IncludeFetcher(fetcher, baseURL, trusted)))
+	if err != nil {
+		return "", fmt.Errorf("unable to inline includes: %w", err)
+	}
+	i.Includes = nil
+	return result, nil
+}
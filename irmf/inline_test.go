@@ -0,0 +1,75 @@
+package irmf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInlineFile(t *testing.T) {
+	header := "/*{\n\"irmf\": \"1.1\",\n\"language\": \"glsl\",\n\"materials\": [\"PLA\"],\n\"max\": [1,1,1],\n\"min\": [0,0,0],\n\"units\": \"mm\"\n}*/\n"
+	files := map[string]string{
+		"https://lygia.xyz/a.glsl":      "#include \"common.glsl\"\nfloat a;",
+		"https://lygia.xyz/b.glsl":      "#include \"common.glsl\"\nfloat b;",
+		"https://lygia.xyz/common.glsl": "#pragma once\nfloat common;",
+	}
+
+	tests := []struct {
+		name    string
+		shader  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "shared dependencies are deduped and annotated",
+			shader: "#include \"lygia/a.glsl\"\n#include \"lygia/b.glsl\"" + testShader,
+			want: strings.Join([]string{
+				"// Inlined from https://lygia.xyz/a.glsl",
+				"// Inlined from https://lygia.xyz/common.glsl",
+				"float common;",
+				"// End of https://lygia.xyz/common.glsl",
+				"float a;",
+				"// End of https://lygia.xyz/a.glsl",
+				"// Inlined from https://lygia.xyz/b.glsl",
+				"float b;",
+				"// End of https://lygia.xyz/b.glsl",
+			}, "\n") + testShader,
+		},
+		{
+			name:   "includes that are not live are commented out",
+			shader: "#ifdef UNDEFINED\n#include \"lygia/a.glsl\"\n#endif\n/*\n  #include \"lygia/b.glsl\"\n*/" + testShader,
+			want:   "#ifdef UNDEFINED\n// #include \"lygia/a.glsl\"\n#endif\n/*\n//   #include \"lygia/b.glsl\"\n*/" + testShader,
+		},
+		{
+			name:    "unrecognized include",
+			shader:  "#include \"mylib/util.glsl\"" + testShader,
+			wantErr: `unable to inline includes: line 1: unrecognized include "mylib/util.glsl"`,
+		},
+		{
+			name:    "missing include",
+			shader:  "#include \"lygia/missing.glsl\"" + testShader,
+			wantErr: "unable to inline includes: line 1: unable to include https://lygia.xyz/missing.glsl: file does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InlineFile([]byte(header+tt.shader), "", MemoryFetcher(files), nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("InlineFile err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InlineFile: %v", err)
+			}
+			_, shaderSrc, err := Parse([]byte(got))
+			if err != nil {
+				t.Fatalf("Parse(InlineFile) = %v\n%v", err, got)
+			}
+			if shaderSrc != tt.want {
+				t.Errorf("InlineFile shader =\n%v\nwant\n%v", shaderSrc, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,397 @@
+// Package irmf parses, validates, and formats IRMF shader files
+// independently of the browser so that it can be shared by the
+// irmf-editor and native command-line tools.
+package irmf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// IRMF represents the JSON header of an IRMF shader.
+type IRMF struct {
+	Author       string        `json:"author"`
+	License      string        `json:"license"`
+	Date         string        `json:"date"`
+	Encoding     *string       `json:"encoding,omitempty"`
+	IRMFVersion  string        `json:"irmf"`
+	GLSLVersion  string        `json:"glslVersion,omitempty"`
+	Includes     []IncludeLock `json:"includes,omitempty"`
+	IncludeHosts []IncludeHost `json:"includeHosts,omitempty"`
+	AllowedHosts []string      `json:"allowedHosts,omitempty"`
+	Language     string        `json:"language"`
+	Materials    []string      `json:"materials"`
+	Max          []float64     `json:"max"`
+	Min          []float64     `json:"min"`
+	Notes        string        `json:"notes"`
+	Options      EditorOptions `json:"options"`
+	Title        string        `json:"title"`
+	Units        string        `json:"units"`
+	Version      string        `json:"version"`
+
+	// warnings are the non-fatal problems found by Validate.
+	warnings []*LineError
+}
+
+// EditorOptions are the irmf-editor-specific display options.
+type EditorOptions struct {
+	Resolution *int  `json:"resolution,omitempty"`
+	Color1     *RGBA `json:"color1,omitempty"`
+	Color2     *RGBA `json:"color2,omitempty"`
+	Color3     *RGBA `json:"color3,omitempty"`
+	Color4     *RGBA `json:"color4,omitempty"`
+	Color5     *RGBA `json:"color5,omitempty"`
+	Color6     *RGBA `json:"color6,omitempty"`
+	Color7     *RGBA `json:"color7,omitempty"`
+	Color8     *RGBA `json:"color8,omitempty"`
+	Color9     *RGBA `json:"color9,omitempty"`
+	Color10    *RGBA `json:"color10,omitempty"`
+	Color11    *RGBA `json:"color11,omitempty"`
+	Color12    *RGBA `json:"color12,omitempty"`
+	Color13    *RGBA `json:"color13,omitempty"`
+	Color14    *RGBA `json:"color14,omitempty"`
+	Color15    *RGBA `json:"color15,omitempty"`
+	Color16    *RGBA `json:"color16,omitempty"`
+}
+
+// RGBA is a material color: red, green, and blue in the range [0,255]
+// and alpha in the range [0,1].
+type RGBA [4]float64
+
+// LineError is an error associated with a (1-based) line number of
+// the IRMF file. A Line of 0 means that the error has no specific location.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string { return e.Err.Error() }
+func (e *LineError) Unwrap() error { return e.Err }
+
+var (
+	// JSONKeys are all the keys recognized in the JSON header by any
+	// supported IRMF version. See VersionKeys for those of one version.
+	JSONKeys = []string{
+		"author",
+		"license",
+		"date",
+		"encoding",
+		"irmf",
+		"glslVersion",
+		"includes",
+		"includeHosts",
+		"allowedHosts",
+		"language",
+		"materials",
+		"max",
+		"min",
+		"notes",
+		"options",
+		"title",
+		"units",
+		"version",
+	}
+	trailingCommaRE = regexp.MustCompile(`,[\s\n]*}`)
+	arrayRE         = regexp.MustCompile(`\[([^\]{]+)\]`)
+	whitespaceRE    = regexp.MustCompile(`[\s\n]+`)
+)
+
+// Parse splits an IRMF file into its JSON header and its (decoded) shader
+// source, then validates the header. Errors are returned as *LineError.
+func Parse(src []byte) (*IRMF, string, error) {
+	if bytes.Index(src, []byte("/*{")) != 0 {
+		return nil, "", &LineError{Line: 1, Err: errors.New(`Unable to find leading "/*{"`)}
+	}
+	jsonBlobStr, body, ok := SplitFile(src)
+	if !ok {
+		err := errors.New(`Unable to find trailing "}*/"`)
+		// Try to find the end of the JSON blob.
+		for _, key := range []string{"*/", "}*", "}"} {
+			if lineNum := FindKeyLine(string(src), key); lineNum > 2 {
+				return nil, "", &LineError{Line: lineNum, Err: err}
+			}
+		}
+		return nil, "", &LineError{Line: 1, Err: err}
+	}
+
+	jsonBlob, err := ParseJSON(jsonBlobStr)
+	if err != nil {
+		return nil, "", &LineError{Line: 2, Err: fmt.Errorf("Unable to parse JSON blob: %v", err)}
+	}
+
+	shaderSrc := string(body)
+	encoded := jsonBlob.Encoding != nil && *jsonBlob.Encoding != ""
+	if encoded {
+		if err := jsonBlob.validateDecoding(); err != nil {
+			return nil, "", &LineError{Line: FindKeyLine(jsonBlobStr, "encoding"), Err: fmt.Errorf("Invalid JSON blob: %v", err)}
+		}
+		if shaderSrc, err = decodeBody(*jsonBlob.Encoding, body); err != nil {
+			return nil, "", &LineError{Err: err}
+		}
+	}
+
+	if keys, err := headerKeys(jsonBlobStr); err == nil && !contains(keys, "language") {
+		jsonBlob.Language = DetectLanguage(shaderSrc)
+	}
+
+	if lineNum, err := jsonBlob.Validate(jsonBlobStr, shaderSrc); err != nil {
+		return nil, "", &LineError{Line: lineNum, Err: fmt.Errorf("Invalid JSON blob: %v", err)}
+	}
+	// The returned shader source is decoded.
+	jsonBlob.Encoding = nil
+
+	if lineNum, err := jsonBlob.ValidateEntryPoint(shaderSrc); err != nil {
+		switch {
+		case lineNum == 0:
+			lineNum = FindKeyLine(jsonBlobStr, "language")
+		case encoded:
+			// The lines of a decoded body are not lines of the file.
+			lineNum = FindKeyLine(jsonBlobStr, "encoding")
+		default:
+			lineNum += bytes.Count(src[:len(src)-len(body)], []byte("\n"))
+		}
+		return nil, "", &LineError{Line: lineNum, Err: err}
+	}
+
+	return jsonBlob, shaderSrc, nil
+}
+
+// SplitFile splits the IRMF file src into its JSON header (without the
+// surrounding "/*" and "*/") and its shader body. The header must start
+// the file with "/*{" and end with a "}*/" line, with either LF or CRLF
+// line endings. ok is false if the header cannot be found.
+func SplitFile(src []byte) (header string, body []byte, ok bool) {
+	if !bytes.HasPrefix(src, []byte("/*{")) {
+		return "", nil, false
+	}
+	for start := 0; ; {
+		n := bytes.Index(src[start:], []byte("\n}*/"))
+		if n < 0 {
+			return "", nil, false
+		}
+		end := start + n
+		rest := src[end+4:]
+		switch {
+		case bytes.HasPrefix(rest, []byte("\n")):
+			return string(src[2 : end+2]), rest[1:], true
+		case bytes.HasPrefix(rest, []byte("\r\n")):
+			return string(src[2 : end+2]), rest[2:], true
+		}
+		start = end + 1
+	}
+}
+
+// fixJSON converts the JavaScript-style object literal of the header
+// into valid JSON.
+func fixJSON(s string) string {
+	// Avoid the trailing comma silliness in JavaScript:
+	s = trailingCommaRE.ReplaceAllString(s, "}")
+
+	if json.Valid([]byte(s)) {
+		return s
+	}
+	for _, key := range JSONKeys {
+		s = strings.Replace(s, key+":", fmt.Sprintf("%q:", key), 1)
+	}
+	return s
+}
+
+// ParseJSON parses the JSON header (without its surrounding comment markers)
+// and fills in default values.
+func ParseJSON(s string) (*IRMF, error) {
+	result := &IRMF{}
+
+	if err := json.Unmarshal([]byte(fixJSON(s)), result); err != nil {
+		return nil, err
+	}
+
+	// Fill in default values:
+	if result.Language == "" {
+		result.Language = "glsl"
+	}
+	if result.Units == "" {
+		result.Units = "mm"
+	}
+
+	return result, nil
+}
+
+// headerKeys returns the top-level keys actually present in the JSON header.
+func headerKeys(s string) ([]string, error) {
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(fixJSON(s)), &m); err != nil {
+		return nil, err
+	}
+	var result []string
+	for k := range m {
+		result = append(result, k)
+	}
+	return result, nil
+}
+
+// Validate checks the header (and the presence of the required model
+// function in shaderSrc) against the rules of its IRMF spec version.
+// On error, it also returns the line number within jsonBlobStr.
+// Non-fatal problems are reported by Warnings.
+func (i *IRMF) Validate(jsonBlobStr, shaderSrc string) (int, error) {
+	i.warnings = nil
+	spec, _ := lookupVersion(i.IRMFVersion)
+	if spec == nil {
+		return FindKeyLine(jsonBlobStr, "irmf"), fmt.Errorf("unsupported IRMF version: %v (supported versions: %v)", i.IRMFVersion, strings.Join(SupportedVersions(), ", "))
+	}
+	if len(i.Materials) < 1 {
+		return FindKeyLine(jsonBlobStr, "materials"), errors.New("must list at least one material name")
+	}
+	if len(i.Materials) > spec.maxMaterials {
+		return FindKeyLine(jsonBlobStr, "materials"), fmt.Errorf("IRMF %v only supports up to %v materials, found %v", spec.version, spec.maxMaterials, len(i.Materials))
+	}
+	if len(i.Max) != 3 {
+		return FindKeyLine(jsonBlobStr, "max"), fmt.Errorf("max must have only 3 values, found %v", len(i.Max))
+	}
+	if len(i.Min) != 3 {
+		return FindKeyLine(jsonBlobStr, "min"), fmt.Errorf("min must have only 3 values, found %v", len(i.Min))
+	}
+	if i.Units == "" {
+		return FindKeyLine(jsonBlobStr, "units"), fmt.Errorf("units are required by IRMF %v", spec.version)
+	}
+	if _, ok := UnitsInMM[i.Units]; !ok {
+		lineNum, err := FindKeyLine(jsonBlobStr, "units"), fmt.Errorf("Unsupported units %q. Possible values are: %v", i.Units, strings.Join(SupportedUnits(), ", "))
+		if spec.strictUnits {
+			return lineNum, err
+		}
+		// IRMF 1.0 does not restrict the units, so only warn about them.
+		i.warnings = append(i.warnings, &LineError{Line: lineNum, Err: err})
+	}
+	if i.Min[0] >= i.Max[0] {
+		return FindKeyLine(jsonBlobStr, "max"), fmt.Errorf("min.x (%v) must be strictly less than max.x (%v)", i.Min[0], i.Max[0])
+	}
+	if i.Min[1] >= i.Max[1] {
+		return FindKeyLine(jsonBlobStr, "max"), fmt.Errorf("min.y (%v) must be strictly less than max.y (%v)", i.Min[1], i.Max[1])
+	}
+	if i.Min[2] >= i.Max[2] {
+		return FindKeyLine(jsonBlobStr, "max"), fmt.Errorf("min.z (%v) must be strictly less than max.z (%v)", i.Min[2], i.Max[2])
+	}
+
+	if entry := EntryPointName(len(i.Materials)); !strings.Contains(shaderSrc, entry) {
+		return FindKeyLine(jsonBlobStr, "materials"), fmt.Errorf("Found %v materials, but missing '%v' function", len(i.Materials), entry)
+	}
+
+	if err := i.validateDecoding(); err != nil {
+		return FindKeyLine(jsonBlobStr, "encoding"), err
+	}
+	if err := i.validateEncoding(); err != nil {
+		// Every supported encoding is read, whatever the IRMF version,
+		// but other tools may not read the ones outside of its spec.
+		i.warnings = append(i.warnings, &LineError{Line: FindKeyLine(jsonBlobStr, "encoding"), Err: err})
+	}
+
+	if err := i.validateIncludes(); err != nil {
+		return FindKeyLine(jsonBlobStr, "includes"), err
+	}
+	if err := i.IncludeSettings().validateHosts(); err != nil {
+		return FindKeyLine(jsonBlobStr, "includeHosts"), err
+	}
+	if err := i.IncludeSettings().validateAllowedHosts(); err != nil {
+		return FindKeyLine(jsonBlobStr, "allowedHosts"), err
+	}
+
+	return spec.validate(i, jsonBlobStr)
+}
+
+// Warnings returns the non-fatal problems found by the last call to
+// Validate (or Parse), with their line numbers within the header.
+func (i *IRMF) Warnings() []*LineError {
+	return i.warnings
+}
+
+// validateDecoding checks that the header's encoding (if any) can be
+// decoded. Files are read with any supported encoding, whatever their
+// IRMF version, since other tools may write them.
+func (i *IRMF) validateDecoding() error {
+	if i.Encoding == nil || *i.Encoding == "" || contains(Encodings(), *i.Encoding) {
+		return nil
+	}
+	return fmt.Errorf("Unsupported encoding %q. Possible values are: %v", *i.Encoding, quoteAll(Encodings()))
+}
+
+// validateEncoding checks that the header's encoding (if any) is
+// supported by its IRMF spec version, which limits the encodings
+// that are written.
+func (i *IRMF) validateEncoding() error {
+	if i.Encoding == nil || *i.Encoding == "" {
+		return nil
+	}
+	spec, _ := lookupVersion(i.IRMFVersion)
+	if spec == nil {
+		return fmt.Errorf("unsupported IRMF version: %v", i.IRMFVersion)
+	}
+	if !contains(spec.encodings, *i.Encoding) {
+		err := fmt.Errorf("Unsupported encoding for IRMF %v. Possible values are: %v", spec.version, quoteAll(spec.encodings))
+		for _, s := range specVersions {
+			if contains(s.encodings, *i.Encoding) {
+				return fmt.Errorf("%v (%q requires IRMF %v)", err, *i.Encoding, s.version)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// FindKeyLine returns the 1-based line number of key within s.
+func FindKeyLine(s, key string) int {
+	if i := strings.Index(s, fmt.Sprintf("%q:", key)); i >= 0 {
+		return indexToLineNum(s, i)
+	}
+	if i := strings.Index(s, fmt.Sprintf("%v:", key)); i >= 0 {
+		return indexToLineNum(s, i)
+	}
+	if i := strings.Index(s, key); i >= 0 {
+		return indexToLineNum(s, i)
+	}
+	return 2 // Fall back to top of json blob.
+}
+
+func indexToLineNum(s string, offset int) int {
+	s = s[:offset]
+	return strings.Count(s, "\n") + 1
+}
+
+// Format returns the canonical text of the IRMF file: the formatted
+// JSON header followed by shaderSrc.
+func (i *IRMF) Format(shaderSrc string) (string, error) {
+	buf, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("unable to format IRMF shader: %v", err)
+	}
+
+	jsonBlob := string(buf)
+
+	// Clean up the JSON.
+	jsonBlob = strings.Replace(jsonBlob, `"options": null,`, `"options": {},`, 1)
+	jsonBlob = arrayRE.ReplaceAllStringFunc(jsonBlob, func(s string) string {
+		return whitespaceRE.ReplaceAllString(s, "")
+	})
+
+	return fmt.Sprintf("/*%v*/\n%v", jsonBlob, shaderSrc), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteAll(list []string) string {
+	var result []string
+	for _, v := range list {
+		result = append(result, fmt.Sprintf("'%v'", v))
+	}
+	return strings.Join(result, ", ")
+}
@@ -0,0 +1,78 @@
+package irmf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSplitFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		wantHeader string
+		wantBody   string
+		wantOK     bool
+	}{
+		{name: "LF", src: "/*{\n\"a\": 1\n}*/\nbody\n", wantHeader: "{\n\"a\": 1\n}", wantBody: "body\n", wantOK: true},
+		{name: "CRLF", src: "/*{\r\n\"a\": 1\r\n}*/\r\nbody\r\n", wantHeader: "{\r\n\"a\": 1\r\n}", wantBody: "body\r\n", wantOK: true},
+		{name: "empty body", src: "/*{\n}*/\n", wantHeader: "{\n}", wantOK: true},
+		{name: "end marker within a line", src: "/*{\n\"a\": \"}*/x\"\n}*/\nbody", wantHeader: "{\n\"a\": \"}*/x\"\n}", wantBody: "body", wantOK: true},
+		{name: "no leading marker", src: "// {\n}*/\nbody"},
+		{name: "no trailing marker", src: "/*{\n\"a\": 1\n}\nbody"},
+		{name: "no newline after trailing marker", src: "/*{\n}*/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, body, ok := SplitFile([]byte(tt.src))
+			if header != tt.wantHeader || string(body) != tt.wantBody || ok != tt.wantOK {
+				t.Errorf("SplitFile = (%q, %q, %v), want (%q, %q, %v)", header, body, ok, tt.wantHeader, tt.wantBody, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseCRLF(t *testing.T) {
+	src := `/*{"irmf":"1.0","language":"glsl","materials":["PLA"],"max":[1,1,1],"min":[0,0,0],` + "\n" + `"units":"mm"` + "\n}*/\n" + testShader
+	jsonBlob, shaderSrc, err := Parse([]byte(strings.ReplaceAll(src, "\n", "\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jsonBlob.Units != "mm" || shaderSrc != strings.ReplaceAll(testShader, "\n", "\r\n") {
+		t.Errorf("Parse = (%+v, %q), want mm units and the shader", jsonBlob, shaderSrc)
+	}
+}
+
+func TestParseEntryPointLine(t *testing.T) {
+	const shader = "float a;\nvoid mainModel4(in vec3 xyz) {\n}\n"
+	header := "/*{\"irmf\":\"1.0\",\"language\":\"glsl\",\"materials\":[\"PLA\"],\n\"max\":[1,1,1],\"min\":[0,0,0],\"units\":\"mm\"%v\n}*/\n"
+	body, err := encodeBody("gzip+base64", shader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		src      string
+		wantLine int
+	}{
+		{name: "plain", src: fmt.Sprintf(header, "") + shader, wantLine: 5},
+		// The lines of a decoded body are not lines of the file.
+		{name: "encoded", src: fmt.Sprintf(header, ",\n\"encoding\":\"gzip+base64\"") + string(body), wantLine: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Parse([]byte(tt.src))
+			var lineErr *LineError
+			if !errors.As(err, &lineErr) || !strings.Contains(err.Error(), "must have the signature") {
+				t.Fatalf("Parse = %v, want a signature error", err)
+			}
+			if lineErr.Line != tt.wantLine {
+				t.Errorf("Parse error line = %v, want %v", lineErr.Line, tt.wantLine)
+			}
+		})
+	}
+}
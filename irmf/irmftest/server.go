@@ -0,0 +1,96 @@
+// Package irmftest provides a local stand-in for the hosts that serve
+// included files so that include resolution, caching, and error paths
+// can be tested without network access.
+package irmftest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/gmlewis/irmf-editor/irmf"
+)
+
+// Server serves files by their original URLs (e.g. "https://lygia.xyz/math/const.glsl")
+// from a local httptest server. Requests sent with its Fetcher for any
+// host are redirected to it.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	files    map[string]string
+	statuses map[string]int
+	requests []string
+}
+
+// NewServer starts a Server serving files, keyed by URL.
+// The caller should call Close when finished.
+func NewServer(files map[string]string) *Server {
+	s := &Server{files: map[string]string{}, statuses: map[string]int{}}
+	for url, content := range files {
+		s.files[url] = content
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Set serves content as the file at url.
+func (s *Server) Set(url, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[url] = content
+}
+
+// Fail responds to all requests for url with the HTTP status code.
+func (s *Server) Fail(url string, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[url] = code
+}
+
+// Requests returns the URLs requested so far, in order.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Fetcher returns an irmf.HTTPFetcher that sends all of its requests to s.
+func (s *Server) Fetcher() irmf.HTTPFetcher {
+	return irmf.HTTPFetcher{Client: &http.Client{Transport: s}}
+}
+
+// RoundTrip implements http.RoundTripper by sending req to s, with the
+// original scheme and host as the first elements of the path.
+func (s *Server) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Path = "/" + req.URL.Scheme + "/" + req.URL.Host + req.URL.Path
+	req.URL.RawPath = ""
+	req.URL.Scheme = "http"
+	req.URL.Host = strings.TrimPrefix(s.URL, "http://")
+	req.Host = req.URL.Host
+	return s.Server.Client().Transport.RoundTrip(req)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	url := r.URL.Path
+	if parts := strings.SplitN(strings.TrimPrefix(url, "/"), "/", 2); len(parts) == 2 {
+		url = parts[0] + "://" + parts[1] // Requested with Fetcher.
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, url)
+	content, ok := s.files[url]
+	code := s.statuses[url]
+	s.mu.Unlock()
+
+	switch {
+	case code != 0:
+		http.Error(w, http.StatusText(code), code)
+	case !ok:
+		http.NotFound(w, r)
+	default:
+		w.Write([]byte(content))
+	}
+}
@@ -0,0 +1,93 @@
+package irmftest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gmlewis/irmf-editor/irmf"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer(map[string]string{
+		"https://lygia.xyz/math/a.glsl":                         "#include \"../space/b.glsl\"\nfloat a;",
+		"https://lygia.xyz/space/b.glsl":                        "float b;",
+		"https://raw.githubusercontent.com/u/r/main/c.glsl":     "float c;",
+		"https://raw.githubusercontent.com/u/r/main/error.glsl": "<html>Oops</html>",
+	})
+	defer s.Close()
+	s.Fail("https://lygia.xyz/down.glsl", http.StatusServiceUnavailable)
+
+	tests := []struct {
+		name    string
+		source  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "nested includes from several hosts",
+			source: "#include \"lygia/math/a.glsl\"\n#include \"github.com/u/r/blob/main/c.glsl\"",
+			want:   "float b;\nfloat a;\nfloat c;",
+		},
+		{
+			name:    "missing",
+			source:  "#include \"lygia/missing.glsl\"",
+			wantErr: "line 1: unable to include https://lygia.xyz/missing.glsl: GET https://lygia.xyz/missing.glsl: 404 Not Found",
+		},
+		{
+			name:    "server error",
+			source:  "#include \"lygia/down.glsl\"",
+			wantErr: "line 1: unable to include https://lygia.xyz/down.glsl: GET https://lygia.xyz/down.glsl: 503 Service Unavailable",
+		},
+		{
+			name:    "HTML response",
+			source:  "#include \"github.com/u/r/blob/main/error.glsl\"",
+			wantErr: "line 1: unable to include https://raw.githubusercontent.com/u/r/main/error.glsl: response is HTML, not shader source",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := irmf.ExpandIncludes(tt.source, irmf.IncludeOptions{}, s.Fetcher())
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("ExpandIncludes err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExpandIncludes: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExpandIncludes =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerRequests(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	s.Set("https://lygia.xyz/a.glsl", "float a;")
+
+	cache := irmf.NewIncludeCache(irmf.NewMemoryCacheStore(), time.Hour, 1<<20)
+	fetch := func(url string) ([]byte, error) {
+		if buf, ok := cache.Get(url); ok {
+			return buf, nil
+		}
+		buf, err := s.Fetcher().Fetch(url)
+		if err == nil {
+			err = cache.Put(url, buf, "")
+		}
+		return buf, err
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := irmf.ExpandIncludes("#include \"lygia/a.glsl\"", irmf.IncludeOptions{}, irmf.FetchFunc(fetch)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := strings.Join(s.Requests(), ","), "https://lygia.xyz/a.glsl"; got != want {
+		t.Errorf("Requests = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,229 @@
+package irmf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// entrySignature describes the required signature of a model entry point
+// for one language.
+type entrySignature struct {
+	// params lists the acceptable (space-separated) qualifiers+type of each parameter.
+	params [][]string
+	// returns lists the acceptable return types.
+	returns []string
+	// want is the canonical signature shown in error messages.
+	want string
+}
+
+// entrySignatures maps language => entry point name => signature.
+// These must be kept in sync with fsFooterFmt* and wgslFooterFmt*.
+var entrySignatures = map[string]map[string]*entrySignature{
+	"glsl": {
+		"mainModel4": {
+			params:  [][]string{{"out vec4"}, {"in vec3", "vec3"}},
+			returns: []string{"void"},
+			want:    "void mainModel4(out vec4 materials, in vec3 xyz)",
+		},
+		"mainModel9": {
+			params:  [][]string{{"out mat3"}, {"in vec3", "vec3"}},
+			returns: []string{"void"},
+			want:    "void mainModel9(out mat3 materials, in vec3 xyz)",
+		},
+		"mainModel16": {
+			params:  [][]string{{"out mat4"}, {"in vec3", "vec3"}},
+			returns: []string{"void"},
+			want:    "void mainModel16(out mat4 materials, in vec3 xyz)",
+		},
+	},
+	"wgsl": {
+		"mainModel4": {
+			params:  [][]string{{"vec3<f32>", "vec3f"}},
+			returns: []string{"vec4<f32>", "vec4f"},
+			want:    "fn mainModel4(xyz: vec3<f32>) -> vec4<f32>",
+		},
+		"mainModel9": {
+			params:  [][]string{{"vec3<f32>", "vec3f"}},
+			returns: []string{"mat3x3<f32>", "mat3x3f"},
+			want:    "fn mainModel9(xyz: vec3<f32>) -> mat3x3<f32>",
+		},
+		"mainModel16": {
+			params:  [][]string{{"vec3<f32>", "vec3f"}},
+			returns: []string{"mat4x4<f32>", "mat4x4f"},
+			want:    "fn mainModel16(xyz: vec3<f32>) -> mat4x4<f32>",
+		},
+	},
+}
+
+var (
+	commentRE       = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*`)
+	wgslTokensRE    = regexp.MustCompile(`\bfn\s+\w+\s*\(|->|\blet\s+\w+|\bvar\s*<|\b(?:vec[234]|mat[234]x[234])<f32>|@(?:fragment|vertex|group|binding|location)\b`)
+	glslTokensRE    = regexp.MustCompile(`\bvoid\s+\w+\s*\(|\b(?:float|int|vec[234]|mat[234])\s+\w+\s*[=;,)(]|^\s*#\s*(?:define|ifdef|ifndef|version)\b`)
+	glslQualifierRE = regexp.MustCompile(`\b(?:const|highp|mediump|lowp|precise)\s+`)
+)
+
+// stripComments replaces all comments in src with spaces, preserving
+// newlines so that offsets and line numbers are unchanged.
+func stripComments(src string) string {
+	return commentRE.ReplaceAllStringFunc(src, func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r == '\n' {
+				return r
+			}
+			return ' '
+		}, s)
+	})
+}
+
+// DetectLanguage guesses whether shaderSrc is written in "glsl" or "wgsl".
+// It returns "glsl" when it cannot tell.
+func DetectLanguage(shaderSrc string) string {
+	src := stripComments(shaderSrc)
+	for _, entry := range []string{"mainModel4", "mainModel9", "mainModel16"} {
+		if findDeclaration("wgsl", src, entry) != nil {
+			return "wgsl"
+		}
+		if findDeclaration("glsl", src, entry) != nil {
+			return "glsl"
+		}
+	}
+	if len(wgslTokensRE.FindAllStringIndex(src, -1)) > len(glslTokensRE.FindAllStringIndex(src, -1)) {
+		return "wgsl"
+	}
+	return "glsl"
+}
+
+// declaration is a parsed function declaration.
+type declaration struct {
+	offset  int
+	text    string
+	params  []string // qualifiers and type of each parameter, normalized
+	returns string
+}
+
+var declarationREs = map[string]func(entry string) *regexp.Regexp{
+	"glsl": func(entry string) *regexp.Regexp {
+		return regexp.MustCompile(`(?m)^[ \t]*(?:(?:highp|mediump|lowp)\s+)?(\w+)\s+` + entry + `\s*\(([^)]*)\)`)
+	},
+	"wgsl": func(entry string) *regexp.Regexp {
+		return regexp.MustCompile(`\bfn\s+` + entry + `\s*\(([^)]*)\)\s*(?:->\s*([^{]+?))?\s*\{`)
+	},
+}
+
+// findDeclaration returns the first declaration of entry in src (which
+// must already have its comments stripped) using the syntax of language,
+// or nil if none is found.
+func findDeclaration(language, src, entry string) *declaration {
+	re := declarationREs[language](entry)
+	for _, m := range re.FindAllStringSubmatchIndex(src, -1) {
+		text := strings.TrimSuffix(strings.TrimSpace(src[m[0]:m[1]]), "{")
+		d := &declaration{offset: m[0], text: strings.Join(strings.Fields(text), " ")}
+		switch language {
+		case "glsl":
+			d.returns = src[m[2]:m[3]]
+			if d.returns == "return" || d.returns == "else" || d.returns == "fn" {
+				continue // This is a call (or WGSL), not a GLSL declaration.
+			}
+			for _, p := range splitParams(src[m[4]:m[5]]) {
+				p = glslQualifierRE.ReplaceAllString(p, "")
+				fields := strings.Fields(p)
+				if len(fields) > 1 {
+					fields = fields[:len(fields)-1] // Drop the parameter name.
+				}
+				d.params = append(d.params, strings.Join(fields, " "))
+			}
+		case "wgsl":
+			if m[4] >= 0 {
+				d.returns = strings.Join(strings.Fields(src[m[4]:m[5]]), "")
+			}
+			for _, p := range splitParams(src[m[2]:m[3]]) {
+				if i := strings.Index(p, ":"); i >= 0 {
+					p = p[i+1:]
+				}
+				d.params = append(d.params, strings.Join(strings.Fields(p), ""))
+			}
+		}
+		return d
+	}
+	return nil
+}
+
+// splitParams splits a parameter list on top-level commas
+// (ignoring those inside "<...>" such as "mat3x3<f32>").
+func splitParams(s string) []string {
+	var result []string
+	var depth, start int
+	for i, r := range s {
+		switch r {
+		case '<':
+			depth++
+		case '>':
+			depth--
+		case ',':
+			if depth == 0 {
+				result = append(result, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		result = append(result, last) // WGSL allows a trailing comma.
+	}
+	return result
+}
+
+// EntryPointSignature returns the required signature of the model entry
+// point entry (e.g. "mainModel4") in language, or "" if there is none.
+func EntryPointSignature(language, entry string) string {
+	if sig, ok := entrySignatures[language][entry]; ok {
+		return sig.want
+	}
+	return ""
+}
+
+// ValidateEntryPoint checks that the model entry point in shaderSrc is
+// declared with the signature expected for the header's language and
+// number of materials. On error, it returns the 1-based line number
+// within shaderSrc of the offending declaration.
+// If no declaration can be found (e.g. it is provided by an included
+// file), no error is returned.
+func (i *IRMF) ValidateEntryPoint(shaderSrc string) (int, error) {
+	entry := EntryPointName(len(i.Materials))
+	sigs, ok := entrySignatures[i.Language]
+	if !ok {
+		return 0, fmt.Errorf("unsupported language %q", i.Language)
+	}
+	sig := sigs[entry]
+
+	src := stripComments(shaderSrc)
+	d := findDeclaration(i.Language, src, entry)
+	if d == nil {
+		for other := range entrySignatures {
+			if other == i.Language {
+				continue
+			}
+			if od := findDeclaration(other, src, entry); od != nil {
+				return indexToLineNum(src, od.offset), fmt.Errorf("language is %q but '%v' is declared using %v syntax: %v", i.Language, entry, strings.ToUpper(other), od.text)
+			}
+		}
+		return 0, nil
+	}
+
+	lineNum := indexToLineNum(src, d.offset)
+	badSignature := func() (int, error) {
+		return lineNum, fmt.Errorf("'%v' must have the signature '%v' for %v, found '%v'", entry, sig.want, strings.ToUpper(i.Language), d.text)
+	}
+	if !contains(sig.returns, d.returns) {
+		return badSignature()
+	}
+	if len(d.params) != len(sig.params) {
+		return badSignature()
+	}
+	for n, p := range d.params {
+		if !contains(sig.params[n], p) {
+			return badSignature()
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,173 @@
+package irmf
+
+import (
+	"strings"
+	"testing"
+)
+
+const wgslShader = `
+fn sphere(radius: f32, xyz: vec3<f32>) -> f32 {
+  let r = length(xyz);
+  return select(0.0, 1.0, r <= radius);
+}
+
+fn mainModel4(xyz: vec3<f32>) -> vec4<f32> {
+  return vec4<f32>(sphere(6.0, xyz), 0.0, 0.0, 0.0);
+}
+`
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name      string
+		shaderSrc string
+		want      string
+	}{
+		{name: "empty", want: "glsl"},
+		{name: "glsl entry point", shaderSrc: testShader, want: "glsl"},
+		{name: "wgsl entry point", shaderSrc: wgslShader, want: "wgsl"},
+		{
+			name:      "wgsl helpers only",
+			shaderSrc: "fn helper(x: f32) -> f32 {\n  let y = x * 2.0;\n  return y;\n}\n",
+			want:      "wgsl",
+		},
+		{
+			name:      "wgsl in comments is ignored",
+			shaderSrc: "// fn mainModel4(xyz: vec3<f32>) -> vec4<f32>\n" + testShader,
+			want:      "glsl",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectLanguage(tt.shaderSrc); got != tt.want {
+				t.Errorf("DetectLanguage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateEntryPoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		language  string
+		materials int
+		shaderSrc string
+		wantLine  int
+		wantErr   string
+	}{
+		{name: "glsl ok", language: "glsl", materials: 1, shaderSrc: testShader},
+		{name: "wgsl ok", language: "wgsl", materials: 1, shaderSrc: wgslShader},
+		{
+			name:      "glsl with precision and no 'in' qualifier",
+			language:  "glsl",
+			materials: 5,
+			shaderSrc: "highp void mainModel9(out mat3 m, highp vec3 xyz) {\n}\n",
+		},
+		{
+			name:      "wgsl shorthand types",
+			language:  "wgsl",
+			materials: 10,
+			shaderSrc: "fn mainModel16(\n  xyz: vec3f,\n) -> mat4x4f {\n  return mat4x4f();\n}\n",
+		},
+		{
+			name:      "call is not a declaration",
+			language:  "glsl",
+			materials: 1,
+			shaderSrc: "void other(out vec4 m, vec3 xyz) {\n  return mainModel4(m, xyz);\n}\n" + testShader,
+		},
+		{
+			name:      "glsl wrong material type",
+			language:  "glsl",
+			materials: 1,
+			shaderSrc: "\n\nvoid mainModel4(out mat3 materials, in vec3 xyz) {\n}\n",
+			wantLine:  3,
+			wantErr:   "'mainModel4' must have the signature 'void mainModel4(out vec4 materials, in vec3 xyz)' for GLSL",
+		},
+		{
+			name:      "glsl missing out qualifier",
+			language:  "glsl",
+			materials: 1,
+			shaderSrc: "void mainModel4(vec4 materials, in vec3 xyz) {\n}\n",
+			wantLine:  1,
+			wantErr:   "must have the signature",
+		},
+		{
+			name:      "wgsl wrong return type",
+			language:  "wgsl",
+			materials: 5,
+			shaderSrc: "// comment\nfn mainModel9(xyz: vec3<f32>) -> mat4x4<f32> {\n}\n",
+			wantLine:  2,
+			wantErr:   "'mainModel9' must have the signature 'fn mainModel9(xyz: vec3<f32>) -> mat3x3<f32>' for WGSL",
+		},
+		{
+			name:      "language mismatch",
+			language:  "glsl",
+			materials: 1,
+			shaderSrc: wgslShader,
+			wantLine:  7,
+			wantErr:   `language is "glsl" but 'mainModel4' is declared using WGSL syntax`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonBlob := &IRMF{Language: tt.language, Materials: make([]string, tt.materials)}
+			line, err := jsonBlob.ValidateEntryPoint(tt.shaderSrc)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateEntryPoint = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateEntryPoint = %v, want %q", err, tt.wantErr)
+			}
+			if line != tt.wantLine {
+				t.Errorf("ValidateEntryPoint line = %v, want %v", line, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestParseDetectsLanguage(t *testing.T) {
+	src := "/*{\n  irmf: \"1.0\",\n  materials: [\"PLA\"],\n  max: [1,1,1],\n  min: [0,0,0],\n}*/\n" + wgslShader
+	jsonBlob, _, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if jsonBlob.Language != "wgsl" {
+		t.Errorf("Language = %q, want %q", jsonBlob.Language, "wgsl")
+	}
+
+	// An explicit but wrong language points at the offending line of the file.
+	src = strings.Replace(src, "irmf: \"1.0\",", "irmf: \"1.0\",\n  language: \"glsl\",", 1)
+	_, _, err = Parse([]byte(src))
+	lineErr, ok := err.(*LineError)
+	if !ok {
+		t.Fatalf("Parse = %v, want *LineError", err)
+	}
+	if want := 14; lineErr.Line != want {
+		t.Errorf("Parse line = %v, want %v: %v", lineErr.Line, want, err)
+	}
+}
+
+func TestEntryPointSignature(t *testing.T) {
+	tests := []struct {
+		language string
+		entry    string
+		want     string
+	}{
+		{language: "glsl", entry: "mainModel4", want: "void mainModel4(out vec4 materials, in vec3 xyz)"},
+		{language: "wgsl", entry: "mainModel16", want: "fn mainModel16(xyz: vec3<f32>) -> mat4x4<f32>"},
+		{language: "glsl", entry: "mainModel5", want: ""},
+		{language: "hlsl", entry: "mainModel4", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.language+"/"+tt.entry, func(t *testing.T) {
+			if got := EntryPointSignature(tt.language, tt.entry); got != tt.want {
+				t.Errorf("EntryPointSignature = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
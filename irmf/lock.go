@@ -0,0 +1,144 @@
+package irmf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// IncludeLock pins the content of one included file, as recorded in the
+// "includes" section of the JSON header.
+type IncludeLock struct {
+	// URL is the resolved URL of the included file.
+	URL string `json:"url"`
+	// Version is the git ref (commit, tag, or branch) of the included
+	// file for GitHub and GitLab raw URLs, or "" if it is unknown.
+	Version string `json:"version,omitempty"`
+	// SHA256 is the hex-encoded SHA-256 hash of the included file.
+	SHA256 string `json:"sha256"`
+}
+
+// IntegrityError reports an included file whose content does not
+// match its lock, or which is missing from the lock.
+type IntegrityError struct {
+	URL string
+	Got string
+	// Want is "" if URL is not locked.
+	Want string
+}
+
+func (e *IntegrityError) Error() string {
+	if e.Want == "" {
+		return fmt.Sprintf("integrity check failed for %v: it is not in the include lock (update the include lock to accept it)", e.URL)
+	}
+	return fmt.Sprintf("integrity check failed for %v: got sha256 %v, want %v (update the include lock to accept the new content)", e.URL, e.Got, e.Want)
+}
+
+var sha256RE = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// hashContent returns the hex-encoded SHA-256 hash of buf.
+func hashContent(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupLock returns the lock for url, or nil if url is not locked.
+func (i *IRMF) lookupLock(url string) *IncludeLock {
+	for n := range i.Includes {
+		if i.Includes[n].URL == url {
+			return &i.Includes[n]
+		}
+	}
+	return nil
+}
+
+// VerifyInclude checks the content buf (fetched from url) against the
+// header's include lock. Without a lock, all includes are accepted;
+// otherwise includes that are not locked are rejected.
+func (i *IRMF) VerifyInclude(url string, buf []byte) error {
+	if len(i.Includes) == 0 {
+		return nil
+	}
+	got := hashContent(buf)
+	lock := i.lookupLock(url)
+	if lock == nil {
+		return &IntegrityError{URL: url, Got: got}
+	}
+	if got != lock.SHA256 {
+		return &IntegrityError{URL: url, Got: got, Want: lock.SHA256}
+	}
+	return nil
+}
+
+// VerifyingFetcher wraps fetcher so that all content it returns is
+// verified against the header's include lock.
+func (i *IRMF) VerifyingFetcher(fetcher Fetcher) Fetcher {
+	return wrappedFetcher{Fetcher: fetcher, fetch: func(url string) ([]byte, error) {
+		buf, err := fetcher.Fetch(url)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.VerifyInclude(url, buf); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}}
+}
+
+// LockIncludes expands all the includes of shaderSrc (see ExpandIncludes)
+// and returns a lock for each included file, in the order they are included.
+func LockIncludes(shaderSrc string, opts IncludeOptions, fetcher Fetcher) ([]IncludeLock, error) {
+	var result []IncludeLock
+	seen := map[string]bool{}
+	recordingFetch := func(url string) ([]byte, error) {
+		buf, err := fetcher.Fetch(url)
+		if err == nil && !seen[url] {
+			seen[url] = true
+			result = append(result, IncludeLock{URL: url, Version: includeVersion(url), SHA256: hashContent(buf)})
+		}
+		return buf, err
+	}
+	if _, err := ExpandIncludes(shaderSrc, opts, wrappedFetcher{Fetcher: fetcher, fetch: recordingFetch}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// gitLabRawMarker separates the repository from the ref and path of a
+// raw GitLab URL such as "https://gitlab.com/user/repo/-/raw/main/a.glsl".
+const gitLabRawMarker = "/-/raw/"
+
+// includeVersion returns the git ref of a raw GitHub or GitLab URL,
+// or "" if the version of url is unknown.
+func includeVersion(url string) string {
+	if root := gitHubRepoRoot(url); root != "" {
+		parts := strings.Split(strings.TrimSuffix(root, "/"), "/")
+		return parts[len(parts)-1]
+	}
+	if _, rest, ok := strings.Cut(url, gitLabRawMarker); ok {
+		if ref, _, ok := strings.Cut(rest, "/"); ok {
+			return ref
+		}
+	}
+	return ""
+}
+
+// validateIncludes checks the "includes" section of the header.
+func (i *IRMF) validateIncludes() error {
+	seen := map[string]bool{}
+	for n, lock := range i.Includes {
+		if lock.URL == "" {
+			return fmt.Errorf("includes[%v] is missing its 'url'", n)
+		}
+		if seen[lock.URL] {
+			return fmt.Errorf("includes[%v]: duplicate url %q", n, lock.URL)
+		}
+		seen[lock.URL] = true
+		if !sha256RE.MatchString(lock.SHA256) {
+			return fmt.Errorf("includes[%v]: 'sha256' must be 64 lowercase hex digits", n)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package irmf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLockIncludes(t *testing.T) {
+	files := map[string]string{
+		"https://lygia.xyz/math/a.glsl":                               "#include \"b.glsl\"\nfloat a;",
+		"https://lygia.xyz/math/b.glsl":                               "float b;",
+		"https://raw.githubusercontent.com/user/repo/v1.2/lib/c.glsl": "float c;",
+	}
+	source := "#include \"lygia/math/a.glsl\"\n#include \"github.com/user/repo/blob/v1.2/lib/c.glsl\"" + testShader
+
+	locks, err := LockIncludes(source, IncludeOptions{}, MemoryFetcher(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IncludeLock{
+		{URL: "https://lygia.xyz/math/a.glsl", SHA256: hashContent([]byte(files["https://lygia.xyz/math/a.glsl"]))},
+		{URL: "https://lygia.xyz/math/b.glsl", SHA256: hashContent([]byte(files["https://lygia.xyz/math/b.glsl"]))},
+		{URL: "https://raw.githubusercontent.com/user/repo/v1.2/lib/c.glsl", Version: "v1.2", SHA256: hashContent([]byte("float c;"))},
+	}
+	if len(locks) != len(want) {
+		t.Fatalf("LockIncludes = %+v, want %+v", locks, want)
+	}
+	for n := range want {
+		if locks[n] != want[n] {
+			t.Errorf("locks[%v] = %+v, want %+v", n, locks[n], want[n])
+		}
+	}
+
+	// The lock survives a round trip through the header.
+	jsonBlob, err := ParseJSON(`{"irmf":"1.1","language":"glsl","materials":["PLA"],"max":[1,1,1],"min":[0,0,0],"units":"mm"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonBlob.Includes = locks
+	out, err := jsonBlob.Format(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := Parse([]byte(out))
+	if err != nil {
+		t.Fatalf("Parse:\n%v\nerror: %v", out, err)
+	}
+	if len(parsed.Includes) != len(locks) {
+		t.Fatalf("Parse includes = %+v, want %+v", parsed.Includes, locks)
+	}
+
+	// Verification.
+	if _, err := ExpandIncludes(source, IncludeOptions{}, parsed.VerifyingFetcher(MemoryFetcher(files))); err != nil {
+		t.Errorf("unchanged includes: %v", err)
+	}
+	files["https://lygia.xyz/math/b.glsl"] = "float changed;"
+	_, err = ExpandIncludes(source, IncludeOptions{}, parsed.VerifyingFetcher(MemoryFetcher(files)))
+	var integrityErr *IntegrityError
+	if !errors.As(err, &integrityErr) || integrityErr.URL != "https://lygia.xyz/math/b.glsl" {
+		t.Errorf("changed include: got err %v, want IntegrityError", err)
+	}
+
+	// Includes that are missing from an existing lock are rejected.
+	files["https://lygia.xyz/math/b.glsl"] = "float b;"
+	files["https://lygia.xyz/math/d.glsl"] = "float d;"
+	_, err = ExpandIncludes(source+"\n#include \"lygia/math/d.glsl\"", IncludeOptions{}, parsed.VerifyingFetcher(MemoryFetcher(files)))
+	if !errors.As(err, &integrityErr) || integrityErr.URL != "https://lygia.xyz/math/d.glsl" || integrityErr.Want != "" {
+		t.Errorf("unlocked include: got err %v, want IntegrityError", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "not in the include lock") {
+		t.Errorf("unlocked include: got err %v, want not in the include lock", err)
+	}
+}
+
+func TestIncludeVersion(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://raw.githubusercontent.com/user/repo/v1.2/lib/c.glsl", want: "v1.2"},
+		{url: "https://raw.githubusercontent.com/user/repo/0a1b2c3/c.glsl", want: "0a1b2c3"},
+		{url: "https://gitlab.com/user/repo/-/raw/main/lib/util.glsl", want: "main"},
+		{url: "https://gitlab.com/group/subgroup/repo/-/raw/v2/util.glsl", want: "v2"},
+		{url: "https://raw.githubusercontent.com/user/repo/c.glsl"},
+		{url: "https://gitlab.com/user/repo/-/raw/main"},
+		{url: "https://lygia.xyz/math/const.glsl"},
+		{url: "file:///tmp/lib/util.glsl"},
+	}
+
+	for _, tt := range tests {
+		if got := includeVersion(tt.url); got != tt.want {
+			t.Errorf("includeVersion(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestValidateIncludes(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	tests := []struct {
+		name     string
+		includes string
+		wantErr  string
+	}{
+		{name: "valid", includes: `[{"url":"https://lygia.xyz/a.glsl","sha256":"` + sum + `"}]`},
+		{name: "missing url", includes: `[{"sha256":"` + sum + `"}]`, wantErr: "missing its 'url'"},
+		{name: "bad hash", includes: `[{"url":"https://lygia.xyz/a.glsl","sha256":"xyz"}]`, wantErr: "64 lowercase hex digits"},
+		{name: "duplicate", includes: `[{"url":"a","sha256":"` + sum + `"},{"url":"a","sha256":"` + sum + `"}]`, wantErr: "duplicate url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonBlobStr := `{"irmf":"1.1","language":"glsl","materials":["PLA"],"max":[1,1,1],"min":[0,0,0],"units":"mm","includes":` + tt.includes + `}`
+			jsonBlob, err := ParseJSON(jsonBlobStr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = jsonBlob.Validate(jsonBlobStr, testShader)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
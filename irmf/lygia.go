@@ -0,0 +1,98 @@
+package irmf
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// lygiaPath returns the path of rawURL within LYGIA (e.g. "math/const.glsl"
+// for "https://lygia.xyz/math/const.glsl"), or false if it is not a LYGIA file.
+func lygiaPath(rawURL string) (string, bool) {
+	p, ok := strings.CutPrefix(rawURL, lygiaBaseURL+"/")
+	if !ok || p == "" || strings.ContainsAny(p, "?#\\") || path.Clean("/" + p)[1:] != p {
+		return "", false
+	}
+	return p, true
+}
+
+// LygiaMirror wraps fetcher so that LYGIA files are retrieved from the
+// local mirror at mirrorURL (a directory written by MirrorLygia, as a
+// "file" URL, or its copy served by "irmf-serve -lygia") rather than from
+// https://lygia.xyz. Includes are still resolved to their https://lygia.xyz
+// URLs, so include locks and caches are unaffected by the mirror.
+func LygiaMirror(mirrorURL string, fetcher Fetcher) Fetcher {
+	return lygiaMirror{Fetcher: fetcher, mirrorURL: strings.TrimSuffix(mirrorURL, "/") + "/"}
+}
+
+// lygiaMirror passes ETags (see ConditionalFetcher) through to its Fetcher.
+type lygiaMirror struct {
+	Fetcher
+	mirrorURL string
+}
+
+func (m lygiaMirror) Fetch(url string) ([]byte, error) {
+	resp, err := m.FetchIfNoneMatch(url, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (m lygiaMirror) FetchIfNoneMatch(url, etag string) (*Response, error) {
+	if p, ok := lygiaPath(url); ok {
+		resp, err := FetchResponse(m.Fetcher, m.mirrorURL+p, etag)
+		if err != nil {
+			return nil, fmt.Errorf("%v is not mirrored (run irmf-lygia to update the mirror): %w", p, err)
+		}
+		return resp, nil
+	}
+	return FetchResponse(m.Fetcher, url, etag)
+}
+
+// MirrorLygia fetches the LYGIA files included (directly or indirectly)
+// by the IRMF file src with fetcher and writes them to the directory dir,
+// laid out like https://lygia.xyz, so that dir can be used by LygiaMirror.
+// baseURL is the URL that src was loaded from, if any, and trusted holds
+// the user's own include settings, if any. Only live includes
+// (see ExpandIncludes) are mirrored, and included files are verified
+// against the header's include lock before anything is written. It
+// returns the paths of the mirrored files within dir.
+func MirrorLygia(src []byte, baseURL, dir string, fetcher Fetcher, trusted *IncludeSettings) ([]string, error) {
+	jsonBlob, shaderSrc, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+	recorder := wrappedFetcher{Fetcher: fetcher, fetch: func(url string) ([]byte, error) {
+		buf, err := fetcher.Fetch(url)
+		if p, ok := lygiaPath(url); ok && err == nil {
+			files[p] = buf
+		}
+		return buf, err
+	}}
+	opts := IncludeOptions{BaseURL: baseURL, Language: jsonBlob.Language}
+	if _, err := ExpandIncludes(shaderSrc, opts, jsonBlob.VerifyingFetcher(jsonBlob.IncludeFetcher(recorder, baseURL, trusted))); err != nil {
+		return nil, fmt.Errorf("unable to mirror includes: %w", err)
+	}
+
+	var paths []string
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		filename := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filename, files[p], 0644); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,98 @@
+package irmf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLygiaPath(t *testing.T) {
+	tests := []struct {
+		url    string
+		want   string
+		wantOK bool
+	}{
+		{url: "https://lygia.xyz/math/const.glsl", want: "math/const.glsl", wantOK: true},
+		{url: "https://lygia.xyz/", wantOK: false},
+		{url: "https://lygia.xyz/../etc/passwd", wantOK: false},
+		{url: "https://lygia.xyz/math//const.glsl", wantOK: false},
+		{url: "https://lygia.xyz/math/const.glsl?v=1", wantOK: false},
+		{url: "https://lygia.xyzzy/math/const.glsl", wantOK: false},
+		{url: "https://raw.githubusercontent.com/user/repo/main/a.glsl", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, ok := lygiaPath(tt.url)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("lygiaPath = (%q, %v), want (%q, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMirrorLygia(t *testing.T) {
+	header := "/*{\n\"irmf\": \"1.1\",\n\"language\": \"glsl\",\n\"materials\": [\"PLA\"],\n\"max\": [1,1,1],\n\"min\": [0,0,0],\n\"units\": \"mm\"\n}*/\n"
+	files := map[string]string{
+		"https://lygia.xyz/sdf/a.glsl":      "#include \"../math/const.glsl\"\nfloat a;",
+		"https://lygia.xyz/sdf/unused.glsl": "float unused;",
+		"https://lygia.xyz/math/const.glsl": "#pragma once\nfloat PI;",
+		"https://example.com/lib/b.glsl":    "float b;",
+	}
+	src := header + "#include \"lygia/sdf/a.glsl\"\n#include \"lib/b.glsl\"\n#ifdef UNDEFINED\n#include \"lygia/sdf/unused.glsl\"\n#endif" + testShader
+
+	dir := t.TempDir()
+	got, err := MirrorLygia([]byte(src), "https://example.com/model.irmf", dir, MemoryFetcher(files), nil)
+	if err != nil {
+		t.Fatalf("MirrorLygia: %v", err)
+	}
+	if want := []string{"math/const.glsl", "sdf/a.glsl"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MirrorLygia = %q, want %q", got, want)
+	}
+	buf, err := os.ReadFile(filepath.Join(dir, "math", "const.glsl"))
+	if err != nil || string(buf) != files["https://lygia.xyz/math/const.glsl"] {
+		t.Errorf("mirrored math/const.glsl = (%q, %v)", buf, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sdf", "unused.glsl")); !os.IsNotExist(err) {
+		t.Errorf("sdf/unused.glsl was mirrored: %v", err)
+	}
+
+	// Only the LYGIA files are read from the mirror.
+	mirrorURL, err := FileURL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := LygiaMirror(mirrorURL, wrappedFetcher{Fetcher: HTTPFetcher{}, fetch: func(url string) ([]byte, error) {
+		if strings.HasPrefix(url, "file:") {
+			return HTTPFetcher{}.Fetch(url)
+		}
+		return MemoryFetcher{"https://example.com/lib/b.glsl": "float b;"}.Fetch(url)
+	}})
+	opts := IncludeOptions{BaseURL: "https://example.com/model.irmf"}
+	expanded, err := ExpandIncludes("#include \"lygia/sdf/a.glsl\"\n#include \"lib/b.glsl\"", opts, fetcher)
+	if err != nil {
+		t.Fatalf("ExpandIncludes(mirror): %v", err)
+	}
+	if want := "float PI;\nfloat a;\nfloat b;"; expanded != want {
+		t.Errorf("ExpandIncludes(mirror) = %q, want %q", expanded, want)
+	}
+
+	_, err = ExpandIncludes("#include \"lygia/sdf/unused.glsl\"", opts, fetcher)
+	if err == nil || !strings.Contains(err.Error(), "sdf/unused.glsl is not mirrored") {
+		t.Errorf("ExpandIncludes(unmirrored) err = %v, want not mirrored", err)
+	}
+}
+
+func TestMirrorLygiaVerifiesLock(t *testing.T) {
+	header := "/*{\n\"irmf\": \"1.1\",\n\"includes\": [{\"url\": \"https://lygia.xyz/a.glsl\", \"sha256\": \"" + strings.Repeat("0", 64) + "\"}],\n\"language\": \"glsl\",\n\"materials\": [\"PLA\"],\n\"max\": [1,1,1],\n\"min\": [0,0,0],\n\"units\": \"mm\"\n}*/\n"
+	dir := t.TempDir()
+	_, err := MirrorLygia([]byte(header+"#include \"lygia/a.glsl\""+testShader), "", dir, MemoryFetcher{"https://lygia.xyz/a.glsl": "float a;"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "integrity check failed") {
+		t.Fatalf("MirrorLygia err = %v, want integrity check failed", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("MirrorLygia wrote %v files despite the failed check", len(entries))
+	}
+}
@@ -0,0 +1,380 @@
+package irmf
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// glslPredefined are the macros predefined by the GLSL ES 3.00 compiler
+// used by the editor.
+var glslPredefined = map[string]string{
+	"GL_ES":       "1",
+	"__VERSION__": "300",
+}
+
+// maxMacroDepth limits the recursive expansion of macros within "#if" expressions.
+const maxMacroDepth = 16
+
+// preprocessor tracks just enough of the GLSL preprocessor state (comments,
+// macro definitions, and conditional directives) to decide which
+// "#include" lines are live. It is shared across all the files of one
+// expansion so that macros defined by included files are honored.
+type preprocessor struct {
+	macros map[string]string
+	conds  []*conditional
+	// inComment means that the previous line ended within a "/* */" comment.
+	inComment bool
+	// continued means that the previous line ended with a backslash.
+	continued bool
+}
+
+// conditional is one open "#if"/"#ifdef"/"#ifndef" group.
+type conditional struct {
+	parentActive bool // the enclosing group is active
+	active       bool // the current branch is active
+	taken        bool // some branch of this group has been active
+}
+
+// newPreprocessor returns a preprocessor for a shader written in language.
+func newPreprocessor(language string) *preprocessor {
+	p := &preprocessor{macros: map[string]string{}}
+	if language == "glsl" {
+		for k, v := range glslPredefined {
+			p.macros[k] = v
+		}
+	}
+	return p
+}
+
+// active reports whether lines at the current position are compiled.
+func (p *preprocessor) active() bool {
+	return len(p.conds) == 0 || p.conds[len(p.conds)-1].active
+}
+
+// line processes the next source line, updating the preprocessor state.
+// It returns the line's code (without comments, trimmed) if the line is
+// live, or "" if it is within a comment or an inactive conditional group.
+func (p *preprocessor) line(line string) string {
+	code := strings.TrimSpace(p.stripComments(line))
+	continued := p.continued
+	p.continued = strings.HasSuffix(code, `\`)
+	if continued || !strings.HasPrefix(code, "#") {
+		if p.active() {
+			return code
+		}
+		return ""
+	}
+
+	name, rest := splitDirective(code)
+	switch name {
+	case "ifdef", "ifndef":
+		_, defined := p.macros[identifierPrefix(rest)]
+		p.push(defined == (name == "ifdef"))
+	case "if":
+		p.push(p.active() && p.evalCondition(rest))
+	case "elif":
+		if c := p.top(); c != nil {
+			c.active = c.parentActive && !c.taken && p.evalCondition(rest)
+			c.taken = c.taken || c.active
+		}
+	case "else":
+		if c := p.top(); c != nil {
+			c.active = c.parentActive && !c.taken
+			c.taken = true
+		}
+	case "endif":
+		if len(p.conds) > 0 {
+			p.conds = p.conds[:len(p.conds)-1]
+		}
+		return "" // The "#endif" itself is never live code.
+	case "define":
+		if p.active() {
+			if name := identifierPrefix(rest); name != "" {
+				value := strings.TrimPrefix(rest, name)
+				if strings.HasPrefix(value, "(") {
+					value = "" // Function-like macros evaluate to 0 in conditions.
+				}
+				p.macros[name] = strings.TrimSuffix(strings.TrimSpace(value), `\`)
+			}
+		}
+	case "undef":
+		if p.active() {
+			delete(p.macros, identifierPrefix(rest))
+		}
+	}
+
+	if p.active() {
+		return code
+	}
+	return ""
+}
+
+func (p *preprocessor) push(active bool) {
+	parentActive := p.active()
+	active = parentActive && active
+	p.conds = append(p.conds, &conditional{parentActive: parentActive, active: active, taken: active})
+}
+
+func (p *preprocessor) top() *conditional {
+	if len(p.conds) == 0 {
+		return nil // Stray directive; leave it for the shader compiler to report.
+	}
+	return p.conds[len(p.conds)-1]
+}
+
+// evalCondition evaluates the expression of an "#if" or "#elif".
+// Expressions that cannot be evaluated are treated as true so that
+// their includes are still fetched, as they were before conditionals
+// were understood.
+func (p *preprocessor) evalCondition(expr string) bool {
+	v, err := p.eval(expr, 0)
+	return err != nil || v != 0
+}
+
+// stripComments replaces the comments within line with spaces, carrying
+// the state of "/* */" comments over to the following line.
+func (p *preprocessor) stripComments(line string) string {
+	var sb strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case p.inComment:
+			if strings.HasPrefix(line[i:], "*/") {
+				p.inComment = false
+				sb.WriteByte(' ')
+				i++
+			}
+		case strings.HasPrefix(line[i:], "//"):
+			return sb.String()
+		case strings.HasPrefix(line[i:], "/*"):
+			p.inComment = true
+			i++
+		case line[i] == '"':
+			end := strings.IndexByte(line[i+1:], '"')
+			if end < 0 {
+				sb.WriteString(line[i:])
+				return sb.String()
+			}
+			sb.WriteString(line[i : i+end+2])
+			i += end + 1
+		default:
+			sb.WriteByte(line[i])
+		}
+	}
+	return sb.String()
+}
+
+// splitDirective splits "#name rest" into its name and (trimmed) rest.
+func splitDirective(code string) (name, rest string) {
+	code = strings.TrimSpace(code[1:])
+	name = identifierPrefix(code)
+	return name, strings.TrimSpace(code[len(name):])
+}
+
+// identifierPrefix returns the identifier at the start of s, if any.
+func identifierPrefix(s string) string {
+	for i, r := range s {
+		if r != '_' && !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && !(i > 0 && '0' <= r && r <= '9') {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+var exprTokenRE = regexp.MustCompile(`^\s*(0[xX][0-9a-fA-F]+[uU]?|\d+[uU]?|[A-Za-z_]\w*|&&|\|\||==|!=|<=|>=|<<|>>|[-+*/%()!<>~&|^])`)
+
+// eval evaluates a preprocessor constant expression.
+func (p *preprocessor) eval(expr string, depth int) (int64, error) {
+	if depth > maxMacroDepth {
+		return 0, fmt.Errorf("macros nested more than %v deep", maxMacroDepth)
+	}
+	var toks []string
+	for rest := strings.TrimSpace(expr); rest != ""; rest = strings.TrimSpace(rest) {
+		m := exprTokenRE.FindStringSubmatch(rest)
+		if m == nil {
+			return 0, fmt.Errorf("unexpected %q in expression %q", rest, expr)
+		}
+		toks = append(toks, m[1])
+		rest = rest[len(m[0]):]
+	}
+	if len(toks) == 0 {
+		return 0, nil
+	}
+
+	e := &exprParser{p: p, toks: toks, depth: depth}
+	v, err := e.binary(0)
+	if err != nil {
+		return 0, err
+	}
+	if e.pos < len(e.toks) {
+		return 0, fmt.Errorf("unexpected %q in expression %q", e.toks[e.pos], expr)
+	}
+	return v, nil
+}
+
+// binaryOps lists the binary operators from lowest to highest precedence.
+var binaryOps = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", ">", "<=", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// exprParser is a recursive-descent parser for "#if" expressions.
+type exprParser struct {
+	p     *preprocessor
+	toks  []string
+	pos   int
+	depth int
+}
+
+func (e *exprParser) peek() string {
+	if e.pos < len(e.toks) {
+		return e.toks[e.pos]
+	}
+	return ""
+}
+
+func (e *exprParser) next() string {
+	tok := e.peek()
+	e.pos++
+	return tok
+}
+
+func (e *exprParser) binary(level int) (int64, error) {
+	if level == len(binaryOps) {
+		return e.unary()
+	}
+	lhs, err := e.binary(level + 1)
+	if err != nil {
+		return 0, err
+	}
+	for contains(binaryOps[level], e.peek()) {
+		op := e.next()
+		rhs, err := e.binary(level + 1)
+		if err != nil {
+			return 0, err
+		}
+		if lhs, err = applyOp(op, lhs, rhs); err != nil {
+			return 0, err
+		}
+	}
+	return lhs, nil
+}
+
+func applyOp(op string, a, b int64) (int64, error) {
+	switch op {
+	case "||":
+		return boolValue(a != 0 || b != 0), nil
+	case "&&":
+		return boolValue(a != 0 && b != 0), nil
+	case "|":
+		return a | b, nil
+	case "^":
+		return a ^ b, nil
+	case "&":
+		return a & b, nil
+	case "==":
+		return boolValue(a == b), nil
+	case "!=":
+		return boolValue(a != b), nil
+	case "<":
+		return boolValue(a < b), nil
+	case ">":
+		return boolValue(a > b), nil
+	case "<=":
+		return boolValue(a <= b), nil
+	case ">=":
+		return boolValue(a >= b), nil
+	case "<<":
+		return a << uint64(b), nil
+	case ">>":
+		return a >> uint64(b), nil
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	}
+	if b == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	if op == "/" {
+		return a / b, nil
+	}
+	return a % b, nil
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (e *exprParser) unary() (int64, error) {
+	switch e.peek() {
+	case "!", "-", "+", "~":
+		op := e.next()
+		v, err := e.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "!":
+			return boolValue(v == 0), nil
+		case "-":
+			return -v, nil
+		case "~":
+			return ^v, nil
+		}
+		return v, nil
+	}
+	return e.primary()
+}
+
+func (e *exprParser) primary() (int64, error) {
+	tok := e.next()
+	switch {
+	case tok == "":
+		return 0, fmt.Errorf("unexpected end of expression")
+	case tok == "(":
+		v, err := e.binary(0)
+		if err != nil {
+			return 0, err
+		}
+		if e.next() != ")" {
+			return 0, fmt.Errorf("missing ')'")
+		}
+		return v, nil
+	case tok == "defined":
+		paren := e.peek() == "("
+		if paren {
+			e.next()
+		}
+		name := e.next()
+		if identifierPrefix(name) == "" {
+			return 0, fmt.Errorf("defined: expected identifier, found %q", name)
+		}
+		if paren && e.next() != ")" {
+			return 0, fmt.Errorf("defined: missing ')'")
+		}
+		_, ok := e.p.macros[name]
+		return boolValue(ok), nil
+	case identifierPrefix(tok) != "":
+		value, ok := e.p.macros[tok]
+		if !ok {
+			return 0, nil // Undefined identifiers evaluate to 0.
+		}
+		return e.p.eval(value, e.depth+1)
+	}
+	return strconv.ParseInt(strings.TrimRight(tok, "uU"), 0, 64)
+}
@@ -0,0 +1,124 @@
+package irmf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandIncludesPreprocessor(t *testing.T) {
+	files := map[string]string{
+		"https://lygia.xyz/a.glsl": "float a;",
+		"https://lygia.xyz/b.glsl": "float b;",
+		"https://lygia.xyz/d.glsl": "#ifndef USE_B\n#define USE_B\n#endif",
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   []string // live includes, in order
+	}{
+		{
+			name:   "line comment",
+			source: "// #include \"lygia/a.glsl\"\n#include \"lygia/b.glsl\"",
+			want:   []string{"b"},
+		},
+		{
+			name:   "block comment",
+			source: "/*\n#include \"lygia/a.glsl\"\n*/\n#include \"lygia/b.glsl\"",
+			want:   []string{"b"},
+		},
+		{
+			name:   "block comment ending before include",
+			source: "/* comment */ #include \"lygia/a.glsl\"",
+			want:   []string{"a"},
+		},
+		{
+			name:   "ifdef undefined",
+			source: "#ifdef USE_A\n#include \"lygia/a.glsl\"\n#else\n#include \"lygia/b.glsl\"\n#endif",
+			want:   []string{"b"},
+		},
+		{
+			name:   "ifdef defined",
+			source: "#define USE_A\n#ifdef USE_A\n#include \"lygia/a.glsl\"\n#else\n#include \"lygia/b.glsl\"\n#endif",
+			want:   []string{"a"},
+		},
+		{
+			name:   "undef",
+			source: "#define USE_A\n#undef USE_A\n#ifndef USE_A\n#include \"lygia/b.glsl\"\n#endif",
+			want:   []string{"b"},
+		},
+		{
+			name:   "if elif else",
+			source: "#define MODE 2\n#if MODE == 1\n#include \"lygia/a.glsl\"\n#elif MODE == 2 && defined(GL_ES)\n#include \"lygia/b.glsl\"\n#else\n#include \"lygia/a.glsl\"\n#endif",
+			want:   []string{"b"},
+		},
+		{
+			name:   "nested inactive group",
+			source: "#if 0\n#ifdef GL_ES\n#include \"lygia/a.glsl\"\n#endif\n#else\n#include \"lygia/b.glsl\"\n#endif",
+			want:   []string{"b"},
+		},
+		{
+			name:   "macro from included file",
+			source: "#include \"lygia/d.glsl\"\n#if defined USE_B\n#include \"lygia/b.glsl\"\n#endif",
+			want:   []string{"d", "b"},
+		},
+		{
+			name:   "unknown expression is live",
+			source: "#if FOO(1)\n#include \"lygia/a.glsl\"\n#endif",
+			want:   []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			fetch := func(url string) ([]byte, error) {
+				got = append(got, strings.TrimSuffix(strings.TrimPrefix(url, "https://lygia.xyz/"), ".glsl"))
+				return MemoryFetcher(files).Fetch(url)
+			}
+			if _, err := ExpandIncludes(tt.source, IncludeOptions{}, FetchFunc(fetch)); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("fetched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreprocessorEval(t *testing.T) {
+	p := newPreprocessor("glsl")
+	p.macros["A"] = "2"
+	p.macros["B"] = "A * 3"
+	p.macros["LOOP"] = "LOOP"
+
+	tests := []struct {
+		expr    string
+		want    int64
+		wantErr bool
+	}{
+		{expr: "1 + 2 * 3", want: 7},
+		{expr: "(1 + 2) * 3", want: 9},
+		{expr: "B == 6", want: 1},
+		{expr: "!defined(C) && defined A", want: 1},
+		{expr: "__VERSION__ >= 300", want: 1},
+		{expr: "0x10 | 1u", want: 17},
+		{expr: "-A < 0 || UNDEFINED", want: 1},
+		{expr: "1 / 0", wantErr: true},
+		{expr: "(1", wantErr: true},
+		{expr: "1 2", wantErr: true},
+		{expr: "LOOP", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := p.eval(tt.expr, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("eval(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("eval(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
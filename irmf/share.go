@@ -0,0 +1,79 @@
+package irmf
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/url"
+	"strings"
+)
+
+const (
+	// ShareLinkWarnLength is the length of a share link beyond which
+	// some chat and email clients truncate it.
+	ShareLinkWarnLength = 2000
+	// ShareLinkMaxLength is the length of a share link beyond which
+	// some browsers and servers reject it.
+	ShareLinkMaxLength = 32000
+)
+
+// ShareFragment returns the URL fragment (without the leading "#") of a
+// self-contained share link for the IRMF file src: "z=" followed by src
+// compressed with gzip and base64url-encoded, then "&crc=" followed by the
+// CRC-32 of src so that truncated or corrupted links are detected.
+func ShareFragment(src string) (string, error) {
+	data, err := gzipBytes([]byte(src))
+	if err != nil {
+		return "", fmt.Errorf("gzip: %v", err)
+	}
+	return fmt.Sprintf("z=%v&crc=%08x", base64.RawURLEncoding.EncodeToString(data), crc32.ChecksumIEEE([]byte(src))), nil
+}
+
+// IsShareFragment reports whether the URL fragment (with or without the
+// leading "#") is that of a share link.
+func IsShareFragment(fragment string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(fragment, "#"), "z=")
+}
+
+// ParseShareFragment returns the IRMF file contained in the URL fragment
+// (with or without the leading "#") of a share link made by ShareFragment.
+func ParseShareFragment(fragment string) (string, error) {
+	q, err := url.ParseQuery(strings.TrimPrefix(fragment, "#"))
+	if err != nil {
+		return "", fmt.Errorf("invalid share link: %v", err)
+	}
+	z := q.Get("z")
+	if z == "" {
+		return "", errors.New("invalid share link: missing the z= data")
+	}
+	crc := q.Get("crc")
+	if crc == "" {
+		return "", errors.New("the share link is truncated: missing its crc= checksum")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(z, "="))
+	if err != nil {
+		return "", fmt.Errorf("the share link is corrupt: %v", err)
+	}
+	src, err := gunzip(data)
+	if err != nil {
+		return "", fmt.Errorf("the share link is corrupt or truncated: %v", err)
+	}
+	if got := fmt.Sprintf("%08x", crc32.ChecksumIEEE(src)); got != strings.ToLower(crc) {
+		return "", fmt.Errorf("the share link is corrupt or truncated: got checksum %v, want %v", got, crc)
+	}
+	return string(src), nil
+}
+
+// ShareLinkWarning returns a warning about the length of a share link,
+// or "" if it is short enough to be shared safely.
+func ShareLinkWarning(link string) string {
+	switch {
+	case len(link) > ShareLinkMaxLength:
+		return fmt.Sprintf("The share link is %v characters long; links longer than %v characters are rejected by some browsers and servers. Consider saving the file and sharing it instead.", len(link), ShareLinkMaxLength)
+	case len(link) > ShareLinkWarnLength:
+		return fmt.Sprintf("The share link is %v characters long; links longer than %v characters may be truncated by some chat and email clients.", len(link), ShareLinkWarnLength)
+	}
+	return ""
+}
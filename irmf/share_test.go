@@ -0,0 +1,65 @@
+package irmf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShareFragment(t *testing.T) {
+	src := "/*{\n  \"irmf\": \"1.0\"\n}*/\n" + testShader
+	fragment, err := ShareFragment(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsShareFragment(fragment) || !IsShareFragment("#"+fragment) {
+		t.Errorf("IsShareFragment(%q) = false, want true", fragment)
+	}
+	if strings.ContainsAny(fragment, "+/ ") {
+		t.Errorf("ShareFragment = %q, want URL-safe characters", fragment)
+	}
+
+	got, err := ParseShareFragment("#" + fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != src {
+		t.Errorf("ParseShareFragment = %q, want %q", got, src)
+	}
+
+	z, crc, _ := strings.Cut(fragment, "&")
+	bomb, err := ShareFragment(strings.Repeat(" ", MaxDecodedSize+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		fragment string
+		wantErr  string
+	}{
+		{name: "missing data", fragment: "crc=00000000", wantErr: "missing the z= data"},
+		{name: "missing checksum", fragment: z, wantErr: "truncated: missing its crc= checksum"},
+		{name: "truncated data", fragment: z[:len(z)/2] + "&" + crc, wantErr: "corrupt or truncated"},
+		{name: "bad base64", fragment: "z=!!!&" + crc, wantErr: "corrupt"},
+		{name: "checksum mismatch", fragment: z + "&crc=00000000", wantErr: "got checksum"},
+		{name: "too large", fragment: bomb, wantErr: "exceeds 16777216 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseShareFragment(tt.fragment); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseShareFragment err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShareLinkWarning(t *testing.T) {
+	if got := ShareLinkWarning(strings.Repeat("x", ShareLinkWarnLength)); got != "" {
+		t.Errorf("short link warning = %q, want none", got)
+	}
+	if got := ShareLinkWarning(strings.Repeat("x", ShareLinkWarnLength+1)); !strings.Contains(got, "may be truncated") {
+		t.Errorf("long link warning = %q, want may be truncated", got)
+	}
+	if got := ShareLinkWarning(strings.Repeat("x", ShareLinkMaxLength+1)); !strings.Contains(got, "rejected") {
+		t.Errorf("very long link warning = %q, want rejected", got)
+	}
+}
@@ -0,0 +1,99 @@
+package irmf
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// sourceHosts lists the forms of source locations understood by SourceURL.
+const sourceHosts = `"github.com/", "gitlab.com/", "gist.github.com/", "bitbucket.org/", or an "https://" URL`
+
+// SourceURL returns the raw URL of the IRMF file at location (the "s="
+// parameter of the editor's URL), which may be one of:
+//
+//	github.com/user/repo/blob/ref/path/model.irmf
+//	gitlab.com/group/project/-/blob/ref/path/model.irmf
+//	gist.github.com/user/id (or gist.github.com/user/id/model.irmf)
+//	bitbucket.org/user/repo/src/ref/path/model.irmf
+//	https://example.com/path/model.irmf
+//
+// An "https://" scheme is optional for the known hosts.
+func SourceURL(location string) (string, error) {
+	location = strings.TrimSpace(location)
+	if location == "" {
+		return "", fmt.Errorf("no source location; use %v", sourceHosts)
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid source location %q: %v", location, err)
+	}
+	if u.Scheme == "" {
+		if u, err = url.Parse("https://" + location); err != nil {
+			return "", fmt.Errorf("invalid source location %q: %v", location, err)
+		}
+	}
+	if u.Scheme != "https" {
+		return "", fmt.Errorf("unable to load %v: only https URLs are supported", location)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("unable to load %v: query strings and fragments are not supported", location)
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	var result string
+	switch strings.ToLower(u.Host) {
+	case "github.com":
+		// user/repo/blob/ref/path...
+		if len(parts) < 5 || (parts[2] != "blob" && parts[2] != "raw") {
+			return "", fmt.Errorf("unable to load %v: expected github.com/user/repo/blob/ref/path/model.irmf", location)
+		}
+		result = GitHubRawPrefix + strings.Join(append(parts[:2:2], parts[3:]...), "/")
+	case "raw.githubusercontent.com":
+		result = u.String()
+	case "gitlab.com":
+		// group/.../project/-/blob/ref/path...
+		i := indexOf(parts, "-")
+		if i < 2 || len(parts) < i+4 || (parts[i+1] != "blob" && parts[i+1] != "raw") {
+			return "", fmt.Errorf("unable to load %v: expected gitlab.com/group/project/-/blob/ref/path/model.irmf", location)
+		}
+		parts[i+1] = "raw"
+		result = "https://gitlab.com/" + strings.Join(parts, "/")
+	case "gist.github.com":
+		// user/id or user/id/file
+		if len(parts) == 2 {
+			// Without a file name, the first file of the gist is loaded.
+			return fmt.Sprintf("https://gist.githubusercontent.com/%v/%v/raw", parts[0], parts[1]), nil
+		}
+		if len(parts) != 3 {
+			return "", fmt.Errorf("unable to load %v: expected gist.github.com/user/id or gist.github.com/user/id/model.irmf", location)
+		}
+		result = fmt.Sprintf("https://gist.githubusercontent.com/%v/%v/raw/%v", parts[0], parts[1], parts[2])
+	case "bitbucket.org":
+		// user/repo/src/ref/path...
+		if len(parts) < 5 || (parts[2] != "src" && parts[2] != "raw") {
+			return "", fmt.Errorf("unable to load %v: expected bitbucket.org/user/repo/src/ref/path/model.irmf", location)
+		}
+		parts[2] = "raw"
+		result = "https://bitbucket.org/" + strings.Join(parts, "/")
+	default:
+		if !strings.Contains(u.Host, ".") {
+			return "", fmt.Errorf("unable to load %v: unknown source location; use %v", location, sourceHosts)
+		}
+		result = u.String()
+	}
+
+	if !strings.HasSuffix(strings.ToLower(result), ".irmf") {
+		return "", fmt.Errorf("unable to load %v: irmf-editor will only load .irmf files", location)
+	}
+	return result, nil
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,50 @@
+package irmf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSourceURL(t *testing.T) {
+	tests := []struct {
+		location string
+		want     string
+		wantErr  string
+	}{
+		{location: "github.com/gmlewis/irmf-examples/blob/master/examples/001-sphere/sphere-1.irmf", want: "https://raw.githubusercontent.com/gmlewis/irmf-examples/master/examples/001-sphere/sphere-1.irmf"},
+		{location: "https://github.com/user/repo/blob/main/a/b.irmf", want: "https://raw.githubusercontent.com/user/repo/main/a/b.irmf"},
+		{location: "https://raw.githubusercontent.com/user/repo/main/b.irmf", want: "https://raw.githubusercontent.com/user/repo/main/b.irmf"},
+		{location: "gitlab.com/group/sub/project/-/blob/main/models/a.irmf", want: "https://gitlab.com/group/sub/project/-/raw/main/models/a.irmf"},
+		{location: "gist.github.com/user/0123abcd", want: "https://gist.githubusercontent.com/user/0123abcd/raw"},
+		{location: "gist.github.com/user/0123abcd/model.irmf", want: "https://gist.githubusercontent.com/user/0123abcd/raw/model.irmf"},
+		{location: "bitbucket.org/user/repo/src/main/model.irmf", want: "https://bitbucket.org/user/repo/raw/main/model.irmf"},
+		{location: "https://example.com/models/Model.IRMF", want: "https://example.com/models/Model.IRMF"},
+		{location: "", wantErr: "no source location"},
+		{location: "http://example.com/model.irmf", wantErr: "only https URLs are supported"},
+		{location: "https://example.com/model.irmf?x=1", wantErr: "query strings and fragments are not supported"},
+		{location: "github.com/user/repo/model.irmf", wantErr: "expected github.com/user/repo/blob/ref/path/model.irmf"},
+		{location: "gitlab.com/group/project/model.irmf", wantErr: "expected gitlab.com/group/project/-/blob/ref/path/model.irmf"},
+		{location: "gist.github.com/user", wantErr: "expected gist.github.com/user/id"},
+		{location: "bitbucket.org/user/repo/model.irmf", wantErr: "expected bitbucket.org/user/repo/src/ref/path/model.irmf"},
+		{location: "github.com/user/repo/blob/main/model.glsl", wantErr: "will only load .irmf files"},
+		{location: "mymodels/model.irmf", wantErr: "unknown source location"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			got, err := SourceURL(tt.location)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SourceURL err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SourceURL: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("SourceURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
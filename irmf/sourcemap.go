@@ -0,0 +1,38 @@
+package irmf
+
+import "fmt"
+
+// SourceLine identifies a line of an original (pre-expansion) source file.
+type SourceLine struct {
+	// URL is the included file, or "" for the top-level shader source.
+	URL string
+	// Line is the 1-based line number within URL (or the top-level source),
+	// or 0 for the comments annotating an inlined file (see IncludeOptions.Inline).
+	Line int
+	// RootLine is the 1-based line number of the top-level source that is
+	// responsible for this line: either the line itself or the "#include"
+	// line that (possibly indirectly) included it.
+	RootLine int
+}
+
+func (s SourceLine) String() string {
+	if s.URL == "" {
+		return fmt.Sprintf("line %v", s.Line)
+	}
+	return fmt.Sprintf("%v:%v (included from line %v)", s.URL, s.Line, s.RootLine)
+}
+
+// SourceMap maps each line of an expanded shader (index 0 is line 1)
+// back to its original file and line.
+type SourceMap []SourceLine
+
+// Lookup translates a 1-based line number of the expanded shader (as
+// reported by a shader compiler) into its original location.
+// It returns false if line is outside of the expanded shader, for
+// example, if it falls within a generated footer.
+func (m SourceMap) Lookup(line int) (SourceLine, bool) {
+	if line < 1 || line > len(m) {
+		return SourceLine{}, false
+	}
+	return m[line-1], true
+}
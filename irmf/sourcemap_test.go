@@ -0,0 +1,41 @@
+package irmf
+
+import "testing"
+
+func TestExpandIncludesWithMap(t *testing.T) {
+	source := "float x;\n#include \"lygia/a.glsl\"\nvoid main() {}"
+	files := map[string]string{
+		"https://lygia.xyz/a.glsl": "#pragma once\n#include \"b.glsl\"\nfloat a;",
+		"https://lygia.xyz/b.glsl": "float b;\nfloat bb;",
+	}
+	got, sourceMap, err := ExpandIncludesWithMap(source, IncludeOptions{}, MemoryFetcher(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "float x;\nfloat b;\nfloat bb;\nfloat a;\nvoid main() {}"; got != want {
+		t.Fatalf("ExpandIncludesWithMap = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		name string
+		line int
+		want SourceLine
+		ok   bool
+	}{
+		{name: "before includes", line: 1, want: SourceLine{Line: 1, RootLine: 1}, ok: true},
+		{name: "nested include", line: 3, want: SourceLine{URL: "https://lygia.xyz/b.glsl", Line: 2, RootLine: 2}, ok: true},
+		{name: "after pragma once", line: 4, want: SourceLine{URL: "https://lygia.xyz/a.glsl", Line: 3, RootLine: 2}, ok: true},
+		{name: "after includes", line: 5, want: SourceLine{Line: 3, RootLine: 3}, ok: true},
+		{name: "zero", line: 0},
+		{name: "footer", line: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := sourceMap.Lookup(tt.line)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Lookup(%v) = (%+v, %v), want (%+v, %v)", tt.line, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package irmf
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UnitsInMM maps each supported IRMF unit to its length in millimeters.
+var UnitsInMM = map[string]float64{
+	"µm": 0.001,
+	"um": 0.001, // ASCII-friendly alias for "µm".
+	"mm": 1.0,
+	"cm": 10.0,
+	"m":  1000.0,
+	"in": 25.4,
+	"ft": 304.8,
+}
+
+// SupportedUnits returns a sorted list of the unit names (for error messages).
+func SupportedUnits() []string {
+	var result []string
+	for k := range UnitsInMM {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// unitsScale returns the factor that converts a length in "from" units
+// into a length in "to" units.
+func unitsScale(from, to string) (float64, error) {
+	f, ok := UnitsInMM[from]
+	if !ok {
+		return 0, fmt.Errorf("unsupported units %q", from)
+	}
+	t, ok := UnitsInMM[to]
+	if !ok {
+		return 0, fmt.Errorf("unsupported units %q", to)
+	}
+	return f / t, nil
+}
+
+var (
+	unitsScaleRE   = regexp.MustCompile(`(?m)^(\s*const(?: float)? unitsScale\s*(?::\s*f32\s*)?=\s*)([^;]+);`)
+	unitsCommentRE = regexp.MustCompile(`(// Units converted from \S+ to )(\S+)( by irmf-editor\.)`)
+)
+
+// ConvertUnits rewrites the MBB of the model into newUnits and wraps the
+// model's entry point so that the xyz input is scaled back into the
+// original units. The resulting model is physically identical to the original.
+// The modified shader source is returned and the irmf header is updated in-place.
+func (i *IRMF) ConvertUnits(shaderSrc, newUnits string) (string, error) {
+	if i.Units == newUnits {
+		return shaderSrc, nil
+	}
+	toNew, err := unitsScale(i.Units, newUnits)
+	if err != nil {
+		return "", err
+	}
+	if len(i.Min) != 3 || len(i.Max) != 3 {
+		return "", fmt.Errorf("min and max must each have 3 values")
+	}
+
+	entry := EntryPointName(len(i.Materials))
+	unscaled := entry + "Unscaled"
+	toOld := 1.0 / toNew
+
+	if m := unitsScaleRE.FindStringSubmatchIndex(shaderSrc); m != nil && strings.Contains(shaderSrc, unscaled) {
+		// The model was already converted once; just update the existing scale factor.
+		oldScale, err := strconv.ParseFloat(strings.TrimSpace(shaderSrc[m[4]:m[5]]), 64)
+		if err != nil {
+			return "", fmt.Errorf("unable to parse existing unitsScale: %v", err)
+		}
+		shaderSrc = shaderSrc[:m[4]] + formatFloat(roundFloat(oldScale*toOld)) + shaderSrc[m[5]:]
+		shaderSrc = unitsCommentRE.ReplaceAllString(shaderSrc, "${1}"+newUnits+"${3}")
+	} else {
+		entryRE := regexp.MustCompile(`\b` + entry + `\b`)
+		shaderSrc = entryRE.ReplaceAllString(shaderSrc, unscaled)
+		shaderSrc = strings.TrimRight(shaderSrc, "\n") + "\n" + unitsWrapper(i.Language, len(i.Materials), i.Units, newUnits, toOld)
+	}
+
+	for n := 0; n < 3; n++ {
+		i.Min[n] = roundFloat(i.Min[n] * toNew)
+		i.Max[n] = roundFloat(i.Max[n] * toNew)
+	}
+	i.Units = newUnits
+
+	return shaderSrc, nil
+}
+
+// EntryPointName returns the name of the model function required
+// for the given number of materials.
+func EntryPointName(numMaterials int) string {
+	switch {
+	case numMaterials <= 4:
+		return "mainModel4"
+	case numMaterials <= 9:
+		return "mainModel9"
+	default:
+		return "mainModel16"
+	}
+}
+
+// unitsWrapper generates a new model entry point that scales its xyz input
+// and calls the original (renamed) entry point.
+func unitsWrapper(language string, numMaterials int, from, to string, scale float64) string {
+	entry := EntryPointName(numMaterials)
+	s := formatFloat(scale)
+	if language == "wgsl" {
+		retType := map[string]string{"mainModel4": "vec4<f32>", "mainModel9": "mat3x3<f32>", "mainModel16": "mat4x4<f32>"}[entry]
+		return fmt.Sprintf(`
+// Units converted from %[1]v to %[2]v by irmf-editor.
+const unitsScale: f32 = %[3]v;
+fn %[4]v(xyz: vec3<f32>) -> %[5]v {
+  return %[4]vUnscaled(xyz * unitsScale);
+}
+`, from, to, s, entry, retType)
+	}
+
+	outType := map[string]string{"mainModel4": "vec4", "mainModel9": "mat3", "mainModel16": "mat4"}[entry]
+	return fmt.Sprintf(`
+// Units converted from %[1]v to %[2]v by irmf-editor.
+const float unitsScale = %[3]v;
+void %[4]v(out %[5]v materials, in vec3 xyz) {
+  %[4]vUnscaled(materials, xyz * unitsScale);
+}
+`, from, to, s, entry, outType)
+}
+
+// roundFloat rounds v to 15 significant digits to remove floating-point
+// noise (e.g. 2.5400000000000005) introduced by unit conversions.
+func roundFloat(v float64) float64 {
+	r, err := strconv.ParseFloat(strconv.FormatFloat(v, 'g', 15, 64), 64)
+	if err != nil {
+		return v
+	}
+	return r
+}
+
+// formatFloat formats a float as a valid GLSL/WGSL floating-point literal.
+func formatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
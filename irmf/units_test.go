@@ -0,0 +1,112 @@
+package irmf
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConvertUnits(t *testing.T) {
+	const glslSrc = `
+void mainModel4(out vec4 materials, in vec3 xyz) {
+  materials[0] = 1.0;
+}
+`
+	tests := []struct {
+		name      string
+		jsonBlob  *IRMF
+		shaderSrc string
+		newUnits  []string
+		wantMin   []float64
+		wantMax   []float64
+		wantParts []string
+		wantErr   bool
+	}{
+		{
+			name:      "mm to cm",
+			jsonBlob:  &IRMF{Language: "glsl", Materials: []string{"PLA"}, Min: []float64{-10, -20, 0}, Max: []float64{10, 20, 30}, Units: "mm"},
+			shaderSrc: glslSrc,
+			newUnits:  []string{"cm"},
+			wantMin:   []float64{-1, -2, 0},
+			wantMax:   []float64{1, 2, 3},
+			wantParts: []string{
+				"void mainModel4Unscaled(out vec4 materials, in vec3 xyz) {",
+				"const float unitsScale = 10.0;",
+				"void mainModel4(out vec4 materials, in vec3 xyz) {\n  mainModel4Unscaled(materials, xyz * unitsScale);",
+			},
+		},
+		{
+			name:      "in to mm then to cm updates existing scale",
+			jsonBlob:  &IRMF{Language: "glsl", Materials: []string{"PLA"}, Min: []float64{0, 0, 0}, Max: []float64{1, 2, 4}, Units: "in"},
+			shaderSrc: glslSrc,
+			newUnits:  []string{"mm", "cm"},
+			wantMin:   []float64{0, 0, 0},
+			wantMax:   []float64{2.54, 5.08, 10.16},
+			wantParts: []string{
+				"const float unitsScale = 0.393700787401575;",
+				"Units converted from in to cm",
+			},
+		},
+		{
+			name:      "wgsl 9 materials",
+			jsonBlob:  &IRMF{Language: "wgsl", Materials: []string{"1", "2", "3", "4", "5"}, Min: []float64{0, 0, 0}, Max: []float64{1, 1, 1}, Units: "m"},
+			shaderSrc: "fn mainModel9(xyz: vec3<f32>) -> mat3x3<f32> {\n  return mat3x3<f32>();\n}\n",
+			newUnits:  []string{"mm"},
+			wantMin:   []float64{0, 0, 0},
+			wantMax:   []float64{1000, 1000, 1000},
+			wantParts: []string{
+				"fn mainModel9Unscaled(xyz: vec3<f32>) -> mat3x3<f32> {",
+				"const unitsScale: f32 = 0.001;",
+				"fn mainModel9(xyz: vec3<f32>) -> mat3x3<f32> {\n  return mainModel9Unscaled(xyz * unitsScale);",
+			},
+		},
+		{
+			name:      "unknown units",
+			jsonBlob:  &IRMF{Language: "glsl", Materials: []string{"PLA"}, Min: []float64{0, 0, 0}, Max: []float64{1, 1, 1}, Units: "mm"},
+			shaderSrc: glslSrc,
+			newUnits:  []string{"furlongs"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.shaderSrc
+			var err error
+			for _, units := range tt.newUnits {
+				if got, err = tt.jsonBlob.ConvertUnits(got, units); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("convertUnits err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			round := func(v []float64) []float64 {
+				var result []float64
+				for _, f := range v {
+					result = append(result, math.Round(f*1e6)/1e6)
+				}
+				return result
+			}
+			if min := round(tt.jsonBlob.Min); !reflect.DeepEqual(min, tt.wantMin) {
+				t.Errorf("min = %v, want %v", min, tt.wantMin)
+			}
+			if max := round(tt.jsonBlob.Max); !reflect.DeepEqual(max, tt.wantMax) {
+				t.Errorf("max = %v, want %v", max, tt.wantMax)
+			}
+			if want := tt.newUnits[len(tt.newUnits)-1]; tt.jsonBlob.Units != want {
+				t.Errorf("units = %q, want %q", tt.jsonBlob.Units, want)
+			}
+			for _, part := range tt.wantParts {
+				if !strings.Contains(got, part) {
+					t.Errorf("convertUnits missing %q in:\n%v", part, got)
+				}
+			}
+		})
+	}
+}
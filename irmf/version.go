@@ -0,0 +1,276 @@
+package irmf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// specVersion describes the rules of one version of the IRMF spec.
+type specVersion struct {
+	version string
+	// draft means that the version is still a proposal that other IRMF
+	// tools (such as the irmf-slicer) do not accept yet. Files are only
+	// migrated to a draft version when it is explicitly requested.
+	draft        bool
+	maxMaterials int
+	encodings    []string
+	// keys lists the header keys defined by this version.
+	// It is frozen once the version is published.
+	keys []string
+	// strictKeys means that keys not in keys are rejected
+	// instead of silently ignored.
+	strictKeys bool
+	// strictUnits means that units other than those of UnitsInMM are
+	// rejected instead of only reported as warnings.
+	strictUnits bool
+	// requireLanguage means that the "language" key must be explicitly present.
+	requireLanguage bool
+	// upgrade migrates a file of this version to the next version.
+	// It is nil for the newest version.
+	upgrade func(i *IRMF, jsonBlobStr string) (changes []string, err error)
+}
+
+var (
+	// keys1p0 are the header keys defined by IRMF 1.0.
+	keys1p0 = []string{
+		"author",
+		"license",
+		"date",
+		"encoding",
+		"irmf",
+		"glslVersion",
+		"language",
+		"materials",
+		"max",
+		"min",
+		"notes",
+		"options",
+		"title",
+		"units",
+		"version",
+	}
+
+	// keys1p1 are the header keys defined by the IRMF 1.1 draft.
+	keys1p1 = []string{
+		"author",
+		"license",
+		"date",
+		"encoding",
+		"irmf",
+		"glslVersion",
+		"includes",
+		"includeHosts",
+		"allowedHosts",
+		"language",
+		"materials",
+		"max",
+		"min",
+		"notes",
+		"options",
+		"title",
+		"units",
+		"version",
+	}
+)
+
+// specVersions lists the supported IRMF spec versions, oldest first.
+var specVersions = []*specVersion{
+	{
+		version:      "1.0",
+		maxMaterials: 16,
+		encodings:    []string{"gzip", "gzip+base64"},
+		keys:         keys1p0,
+		upgrade:      upgrade1p0To1p1,
+	},
+	{
+		version:         "1.1",
+		draft:           true,
+		maxMaterials:    16,
+		encodings:       Encodings(),
+		keys:            keys1p1,
+		strictKeys:      true,
+		strictUnits:     true,
+		requireLanguage: true,
+	},
+}
+
+// LatestVersion is the newest published (non-draft) IRMF spec version
+// supported by this package.
+var LatestVersion = latestVersion()
+
+func latestVersion() string {
+	for n := len(specVersions) - 1; n >= 0; n-- {
+		if !specVersions[n].draft {
+			return specVersions[n].version
+		}
+	}
+	return specVersions[0].version
+}
+
+// SupportedVersions returns the supported IRMF spec versions, oldest first,
+// including drafts.
+func SupportedVersions() []string {
+	var result []string
+	for _, s := range specVersions {
+		result = append(result, s.version)
+	}
+	return result
+}
+
+// IsDraftVersion reports whether IRMF version v is a draft that
+// other IRMF tools do not accept yet.
+func IsDraftVersion(v string) bool {
+	s, _ := lookupVersion(v)
+	return s != nil && s.draft
+}
+
+// VersionKeys returns the header keys defined by IRMF version v,
+// or nil if v is not supported.
+func VersionKeys(v string) []string {
+	s, _ := lookupVersion(v)
+	if s == nil {
+		return nil
+	}
+	return append([]string(nil), s.keys...)
+}
+
+// lookupVersion returns the rules for IRMF version v and its index
+// in specVersions, or nil if v is not supported.
+func lookupVersion(v string) (*specVersion, int) {
+	for n, s := range specVersions {
+		if s.version == v {
+			return s, n
+		}
+	}
+	return nil, -1
+}
+
+// validate applies the version-specific rules that are not shared by all versions.
+func (s *specVersion) validate(i *IRMF, jsonBlobStr string) (int, error) {
+	keys, err := headerKeys(jsonBlobStr)
+	if err != nil {
+		return 2, err
+	}
+	for _, key := range keys {
+		if contains(s.keys, key) {
+			continue
+		}
+		if s.strictKeys {
+			return FindKeyLine(jsonBlobStr, key), fmt.Errorf("unknown key %q is not allowed by IRMF %v", key, s.version)
+		}
+		// IRMF 1.0 ignores unknown keys, so only warn about them.
+		err := fmt.Errorf("unknown key %q is ignored by IRMF %v", key, s.version)
+		for _, later := range specVersions {
+			if contains(later.keys, key) {
+				err = fmt.Errorf("%v (%q requires IRMF %v)", err, key, later.version)
+				break
+			}
+		}
+		i.warnings = append(i.warnings, &LineError{Line: FindKeyLine(jsonBlobStr, key), Err: err})
+	}
+	if !s.requireLanguage {
+		return 0, nil
+	}
+
+	if !contains(keys, "language") {
+		return 2, fmt.Errorf("IRMF %v requires the 'language' key (\"glsl\" or \"wgsl\")", s.version)
+	}
+	if i.Language != "glsl" && i.Language != "wgsl" {
+		return FindKeyLine(jsonBlobStr, "language"), fmt.Errorf("unsupported language %q. Possible values are 'glsl' or 'wgsl'", i.Language)
+	}
+
+	return 0, nil
+}
+
+// upgrade1p0To1p1 makes the implicit defaults of IRMF 1.0 explicit
+// and drops header keys that are not part of the IRMF 1.1 draft.
+func upgrade1p0To1p1(i *IRMF, jsonBlobStr string) ([]string, error) {
+	keys, err := headerKeys(jsonBlobStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !contains(keys1p1, key) {
+			changes = append(changes, fmt.Sprintf("removed unknown key %q", key))
+		}
+	}
+	if !contains(keys, "language") {
+		changes = append(changes, fmt.Sprintf("added explicit language %q", i.Language))
+	}
+	if !contains(keys, "units") {
+		changes = append(changes, fmt.Sprintf("added explicit units %q", i.Units))
+	}
+	return changes, nil
+}
+
+// Migrate upgrades a parsed IRMF file step-by-step to IRMF version to.
+// jsonBlobStr is the original JSON header, used to detect which keys
+// were actually present. It returns a human-readable list of changes.
+// The header is updated in-place.
+func (i *IRMF) Migrate(jsonBlobStr, to string) ([]string, error) {
+	target, targetN := lookupVersion(to)
+	if target == nil {
+		return nil, fmt.Errorf("unsupported IRMF version: %v (supported versions: %v)", to, strings.Join(SupportedVersions(), ", "))
+	}
+	if _, n := lookupVersion(i.IRMFVersion); n > targetN {
+		return nil, fmt.Errorf("cannot downgrade from IRMF %v to %v", i.IRMFVersion, to)
+	}
+
+	var changes []string
+	for i.IRMFVersion != to {
+		spec, n := lookupVersion(i.IRMFVersion)
+		if spec == nil {
+			return changes, fmt.Errorf("unsupported IRMF version: %v", i.IRMFVersion)
+		}
+		if spec.upgrade == nil {
+			return changes, fmt.Errorf("no migration path from IRMF %v to %v", i.IRMFVersion, to)
+		}
+		stepChanges, err := spec.upgrade(i, jsonBlobStr)
+		if err != nil {
+			return changes, fmt.Errorf("migrating from IRMF %v: %v", i.IRMFVersion, err)
+		}
+		next := specVersions[n+1].version
+		changes = append(changes, fmt.Sprintf("irmf: %q => %q", i.IRMFVersion, next))
+		changes = append(changes, stepChanges...)
+		i.IRMFVersion = next
+	}
+	return changes, nil
+}
+
+// MigrateFile parses an IRMF file, upgrades it to IRMF version to, and
+// returns the newly-formatted file along with the list of changes.
+// The shader body keeps its encoding unless the version does not
+// support it, in which case it is decoded and the change is listed.
+func MigrateFile(src []byte, to string) (string, []string, error) {
+	jsonBlob, shaderSrc, err := Parse(src)
+	if err != nil {
+		return "", nil, err
+	}
+	// Parse decodes the shader body, so get its encoding from the header.
+	jsonBlobStr, _, _ := SplitFile(src)
+	var encoding string
+	if header, err := ParseJSON(jsonBlobStr); err == nil && header.Encoding != nil {
+		encoding = *header.Encoding
+	}
+
+	changes, err := jsonBlob.Migrate(jsonBlobStr, to)
+	if err != nil {
+		return "", nil, err
+	}
+	if spec, _ := lookupVersion(jsonBlob.IRMFVersion); encoding != "" && !contains(spec.encodings, encoding) {
+		changes = append(changes, fmt.Sprintf("decoded the shader body, since IRMF %v does not support encoding %q", spec.version, encoding))
+		encoding = ""
+	}
+	out, err := jsonBlob.Encode(shaderSrc, encoding)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, _, err := Parse(out); err != nil {
+		return "", nil, fmt.Errorf("migrated file is invalid: %v", err)
+	}
+	return string(out), changes, nil
+}
@@ -0,0 +1,274 @@
+package irmf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testShader = `
+void mainModel4(out vec4 materials, in vec3 xyz) {
+  materials[0] = 1.0;
+}
+`
+
+func TestValidateVersions(t *testing.T) {
+	tests := []struct {
+		name        string
+		jsonBlob    string
+		wantLine    int
+		wantErr     string
+		wantWarning string
+	}{
+		{
+			name:        "1.0 warns about unknown keys",
+			jsonBlob:    "{\"irmf\":\"1.0\",\"materials\":[\"PLA\"],\"max\":[1,1,1],\"min\":[0,0,0],\n\"color\":\"red\"}",
+			wantLine:    2,
+			wantWarning: `unknown key "color" is ignored by IRMF 1.0`,
+		},
+		{
+			name:        "1.0 warns about keys of later versions",
+			jsonBlob:    "{\"irmf\":\"1.0\",\"materials\":[\"PLA\"],\"max\":[1,1,1],\"min\":[0,0,0],\n\"allowedHosts\":[\"lygia.xyz\"]}",
+			wantLine:    2,
+			wantWarning: `unknown key "allowedHosts" is ignored by IRMF 1.0 ("allowedHosts" requires IRMF 1.1)`,
+		},
+		{
+			name:        "1.0 warns about unknown units",
+			jsonBlob:    "{\"irmf\":\"1.0\",\"materials\":[\"PLA\"],\"max\":[1,1,1],\"min\":[0,0,0],\n\"units\":\"furlong\"}",
+			wantLine:    2,
+			wantWarning: `Unsupported units "furlong"`,
+		},
+		{
+			name:     "1.1 rejects unknown units",
+			jsonBlob: "{\"irmf\":\"1.1\",\"language\":\"glsl\",\"materials\":[\"PLA\"],\"max\":[1,1,1],\"min\":[0,0,0],\n\"units\":\"furlong\"}",
+			wantLine: 2,
+			wantErr:  `Unsupported units "furlong"`,
+		},
+		{
+			name:     "unsupported version",
+			jsonBlob: "{\n\"irmf\":\"3.0\",\n\"materials\":[\"PLA\"],\"max\":[1,1,1],\"min\":[0,0,0]}",
+			wantLine: 2,
+			wantErr:  "unsupported IRMF version: 3.0",
+		},
+		{
+			name:     "1.1 valid",
+			jsonBlob: `{"irmf":"1.1","language":"glsl","materials":["PLA"],"max":[1,1,1],"min":[0,0,0],"units":"mm"}`,
+		},
+		{
+			name:     "1.1 rejects unknown key",
+			jsonBlob: "{\"irmf\":\"1.1\",\"language\":\"glsl\",\n\"materials\":[\"PLA\"],\"max\":[1,1,1],\"min\":[0,0,0],\n\"color\":\"red\"}",
+			wantLine: 3,
+			wantErr:  `unknown key "color" is not allowed by IRMF 1.1`,
+		},
+		{
+			name:     "1.1 requires language",
+			jsonBlob: `{"irmf":"1.1","materials":["PLA"],"max":[1,1,1],"min":[0,0,0]}`,
+			wantLine: 2,
+			wantErr:  "IRMF 1.1 requires the 'language' key",
+		},
+		{
+			name:     "1.1 rejects unknown language",
+			jsonBlob: `{"irmf":"1.1","language":"hlsl","materials":["PLA"],"max":[1,1,1],"min":[0,0,0]}`,
+			wantLine: 1,
+			wantErr:  `unsupported language "hlsl"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonBlob, err := ParseJSON(tt.jsonBlob)
+			if err != nil {
+				t.Fatalf("ParseJSON: %v", err)
+			}
+			line, err := jsonBlob.Validate(tt.jsonBlob, testShader)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate = %v, want nil", err)
+				}
+				warnings := jsonBlob.Warnings()
+				if tt.wantWarning == "" {
+					if len(warnings) != 0 {
+						t.Errorf("Warnings = %v, want none", warnings)
+					}
+					return
+				}
+				if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), tt.wantWarning) {
+					t.Fatalf("Warnings = %v, want %q", warnings, tt.wantWarning)
+				}
+				if warnings[0].Line != tt.wantLine {
+					t.Errorf("Warnings line = %v, want %v", warnings[0].Line, tt.wantLine)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate = %v, want %q", err, tt.wantErr)
+			}
+			if line != tt.wantLine {
+				t.Errorf("Validate line = %v, want %v", line, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	src := `/*{
+  irmf: "1.0",
+  materials: ["PLA"],
+  max: [10,10,10],
+  min: [0,0,0],
+  "color": "red",
+}*/
+` + testShader
+
+	got, changes, err := MigrateFile([]byte(src), "1.1")
+	if err != nil {
+		t.Fatalf("MigrateFile: %v", err)
+	}
+
+	wantChanges := []string{
+		`irmf: "1.0" => "1.1"`,
+		`removed unknown key "color"`,
+		`added explicit language "glsl"`,
+		`added explicit units "mm"`,
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("changes = %#v, want %#v", changes, wantChanges)
+	}
+	for _, want := range []string{`"irmf": "1.1",`, `"language": "glsl",`, `"units": "mm",`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("MigrateFile missing %q in:\n%v", want, got)
+		}
+	}
+	if strings.Contains(got, "color") {
+		t.Errorf("MigrateFile did not remove unknown key:\n%v", got)
+	}
+
+	// Migrating again is a no-op.
+	again, changes, err := MigrateFile([]byte(got), "1.1")
+	if err != nil {
+		t.Fatalf("MigrateFile(again): %v", err)
+	}
+	if len(changes) != 0 || again != got {
+		t.Errorf("MigrateFile(again) = %v changes, want none", changes)
+	}
+}
+
+func TestMigrateFileEncoded(t *testing.T) {
+	jsonBlob := &IRMF{IRMFVersion: "1.0", Materials: []string{"PLA"}, Min: []float64{0, 0, 0}, Max: []float64{10, 10, 10}}
+	gzipped, err := jsonBlob.Encode(testShader, "gzip+base64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Other tools may write encodings that IRMF 1.0 does not define.
+	body, err := encodeBody("zlib", testShader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zlibbed := append([]byte("/*{\n\"irmf\": \"1.0\",\n\"materials\": [\"PLA\"],\n\"max\": [10,10,10],\n\"min\": [0,0,0],\n\"encoding\": \"zlib\"\n}*/\n"), body...)
+
+	tests := []struct {
+		name         string
+		src          []byte
+		to           string
+		wantEncoding string
+		wantChange   string
+	}{
+		{name: "keeps the encoding", src: gzipped, to: "1.1", wantEncoding: "gzip+base64"},
+		{name: "keeps a newer encoding", src: zlibbed, to: "1.1", wantEncoding: "zlib"},
+		{
+			name:       "decodes an unsupported encoding",
+			src:        zlibbed,
+			to:         "1.0",
+			wantChange: `decoded the shader body, since IRMF 1.0 does not support encoding "zlib"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changes, err := MigrateFile(tt.src, tt.to)
+			if err != nil {
+				t.Fatalf("MigrateFile: %v", err)
+			}
+			header, body, _ := SplitFile([]byte(got))
+			jsonBlob, err := ParseJSON(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var encoding string
+			if jsonBlob.Encoding != nil {
+				encoding = *jsonBlob.Encoding
+			}
+			if encoding != tt.wantEncoding {
+				t.Errorf("MigrateFile encoding = %q, want %q", encoding, tt.wantEncoding)
+			}
+			if shaderSrc, err := decodeBody(encoding, body); err != nil || shaderSrc != testShader {
+				t.Errorf("MigrateFile body = (%q, %v), want the shader", shaderSrc, err)
+			}
+			if tt.wantChange != "" && !contains(changes, tt.wantChange) {
+				t.Errorf("changes = %#v, want %q", changes, tt.wantChange)
+			}
+		})
+	}
+}
+
+func TestMigrateFileLatestVersion(t *testing.T) {
+	if LatestVersion != "1.0" {
+		t.Errorf("LatestVersion = %q, want the newest published version %q", LatestVersion, "1.0")
+	}
+	if !IsDraftVersion("1.1") || IsDraftVersion("1.0") {
+		t.Errorf("IsDraftVersion(1.1) = %v, IsDraftVersion(1.0) = %v, want true, false", IsDraftVersion("1.1"), IsDraftVersion("1.0"))
+	}
+
+	src := `/*{
+  irmf: "1.0",
+  materials: ["PLA"],
+  max: [10,10,10],
+  min: [0,0,0],
+}*/
+` + testShader
+
+	// Valid 1.0 files are not upgraded to a draft version unless asked to.
+	got, changes, err := MigrateFile([]byte(src), LatestVersion)
+	if err != nil {
+		t.Fatalf("MigrateFile: %v", err)
+	}
+	if len(changes) != 0 || !strings.Contains(got, `"irmf": "1.0",`) {
+		t.Errorf("MigrateFile(%v) = %v changes, want none:\n%v", LatestVersion, changes, got)
+	}
+
+	draft, _, err := MigrateFile([]byte(src), "1.1")
+	if err != nil {
+		t.Fatalf("MigrateFile(1.1): %v", err)
+	}
+	if _, _, err := MigrateFile([]byte(draft), "1.0"); err == nil || !strings.Contains(err.Error(), "cannot downgrade") {
+		t.Errorf("MigrateFile(1.1 => 1.0) = %v, want downgrade error", err)
+	}
+	if _, _, err := MigrateFile([]byte(src), "3.0"); err == nil || !strings.Contains(err.Error(), "unsupported IRMF version: 3.0") {
+		t.Errorf("MigrateFile(3.0) = %v, want unsupported version error", err)
+	}
+}
+
+func TestVersionKeys(t *testing.T) {
+	keys := VersionKeys("1.0")
+	if len(keys) != 15 || contains(keys, "includes") {
+		t.Errorf("VersionKeys(1.0) = %v, want the 15 keys of IRMF 1.0", keys)
+	}
+	if !contains(VersionKeys("1.1"), "includes") {
+		t.Errorf("VersionKeys(1.1) = %v, want includes", VersionKeys("1.1"))
+	}
+	if got := VersionKeys("3.0"); got != nil {
+		t.Errorf("VersionKeys(3.0) = %v, want nil", got)
+	}
+
+	// The key lists are frozen: neither the result nor JSONKeys changes them.
+	keys[0] = "changed"
+	saved := JSONKeys
+	JSONKeys = append(JSONKeys, "extra")
+	defer func() { JSONKeys = saved }()
+	if got := VersionKeys("1.0"); got[0] != "author" || contains(got, "extra") {
+		t.Errorf("VersionKeys(1.0) = %v, want it unchanged", got)
+	}
+	if contains(VersionKeys("1.1"), "extra") {
+		t.Errorf("VersionKeys(1.1) = %v, want it unchanged", VersionKeys("1.1"))
+	}
+}
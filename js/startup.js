@@ -208,54 +208,153 @@ let goAlreadyCached = null
 function installAlreadyCached(cb) { goAlreadyCached = cb }
 let goSaveToCache = null
 function installSaveToCache(cb) { goSaveToCache = cb }
+let goCachedETag = null
+function installCachedETag(cb) { goCachedETag = cb }
+let goNotModified = null
+function installNotModified(cb) { goNotModified = cb }
 let goCompileCallback = null
 function installCompileShader(cb) { goCompileCallback = cb }
 let goJSONOptionsCallback = null
 function installUpdateJSONOptionsCallback(cb) { goJSONOptionsCallback = cb }
+let goConvertUnitsCallback = null
+function installConvertUnits(cb) { goConvertUnitsCallback = cb }
+let goExportShaderCallback = null
+function installExportShader(cb) { goExportShaderCallback = cb }
+let goShareLinkCallback = null
+function installShareLink(cb) { goShareLinkCallback = cb }
+let goListHistoryCallback = null
+function installListHistory(cb) { goListHistoryCallback = cb }
+let goDiffHistoryCallback = null
+function installDiffHistory(cb) { goDiffHistoryCallback = cb }
+let goRestoreHistoryCallback = null
+function installRestoreHistory(cb) { goRestoreHistoryCallback = cb }
+let goOpenFileCallback = null
+function installOpenFile(cb) { goOpenFileCallback = cb }
+let goReloadSourceCallback = null
+function installReloadSource(cb) { goReloadSourceCallback = cb }
+let goCompileSucceededCallback = null
+function installCompileSucceeded(cb) { goCompileSucceededCallback = cb }
+
+// watchSource reloads the editor whenever "irmf-serve -watch" reports that
+// the watched file (or one of its includes) changed.
+function watchSource(eventsURL) {
+  const events = new EventSource(eventsURL)
+  events.onmessage = (e) => {
+    if (!goReloadSourceCallback) { console.log('reloadSourceCallback missing'); return }
+    const msg = JSON.parse(e.data)
+    goReloadSourceCallback(msg.source, msg.changed)
+  }
+  events.onerror = () => { console.log('Lost the connection to irmf-serve; reconnecting...') }
+}
+let goSaveFileCallback = null
+function installSaveFile(cb) { goSaveFileCallback = cb }
+
+// openFile loads the local IRMF file (a File) into the editor and compiles it.
+function openFile(file) {
+  if (!goOpenFileCallback) { console.log('openFileCallback missing'); return }
+  file.arrayBuffer().then((buf) => {
+    // The page URL no longer describes the editor buffer.
+    history.replaceState(null, '', window.location.pathname)
+    if (goOpenFileCallback(new Uint8Array(buf), file.name)) { compileShader() }
+  }).catch((e) => { alert(`Unable to read ${file.name}: ${e}`) })
+}
+let goMapSourceLineCallback = null
+function installMapSourceLine(cb) { goMapSourceLineCallback = cb }
+let goPendingIncludesCallback = null
+function installPendingIncludes(cb) { goPendingIncludesCallback = cb }
+let goUpdateIncludeLockCallback = null
+function installUpdateIncludeLock(cb) { goUpdateIncludeLockCallback = cb }
+let goInlineIncludesCallback = null
+function installInlineIncludes(cb) { goInlineIncludesCallback = cb }
+let goListIncludeCacheCallback = null
+function installListIncludeCache(cb) { goListIncludeCacheCallback = cb }
+let goClearIncludeCacheCallback = null
+function installClearIncludeCache(cb) { goClearIncludeCacheCallback = cb }
+let goTrustedHostsCallback = null
+function installTrustedHosts(cb) { goTrustedHostsCallback = cb }
+
+// mapCompilerLine translates a line number of the compiled model source
+// into the editor line to highlight. For code coming from an included file,
+// 'include' describes its origin as 'url:line'.
+function mapCompilerLine(line) {
+  const loc = goMapSourceLineCallback ? goMapSourceLineCallback(line) : null
+  if (!loc) {
+    return { editorLine: line, include: '' }
+  }
+  return { editorLine: loc.editorLine, include: loc.url ? loc.url + ':' + loc.line : '' }
+}
+
+// saveAs downloads data (a Uint8Array or string) to the user's computer.
+function saveAs(data, filename) {
+  const blob = new Blob([data], { type: 'application/octet-stream' })
+  const a = document.createElement('a')
+  a.href = URL.createObjectURL(blob)
+  a.download = filename
+  document.body.appendChild(a)
+  a.click()
+  document.body.removeChild(a)
+  setTimeout(function () { URL.revokeObjectURL(a.href) }, 0)
+}
+
+// lygiaMirror is the LYGIA mirror served by "irmf-serve -lygia", if any.
+const lygiaMirror = document.querySelector('meta[name="lygia-mirror"]')
+const lygiaPrefix = 'https://lygia.xyz/'
+
+// downloadURL returns where url is downloaded from (while it is still
+// cached as url): LYGIA files are read from the mirror, if any.
+const downloadURL = (url) => {
+  if (!lygiaMirror || !url.startsWith(lygiaPrefix)) { return url }
+  return lygiaMirror.content + url.substring(lygiaPrefix.length)
+}
 
 const getFile = (url) => {
   if (goAlreadyCached(url)) { return }
   const httpRequest = new XMLHttpRequest()
-  httpRequest.open("GET", url, false)
-  httpRequest.send()
+  httpRequest.open("GET", downloadURL(url), false)
+  // Revalidate an expired cached copy instead of downloading it again.
+  const etag = goCachedETag ? goCachedETag(url) : ''
+  if (etag) { httpRequest.setRequestHeader('If-None-Match', etag) }
+  try {
+    httpRequest.send()
+  } catch (e) {
+    console.log(`Unable to get code from ${url}: ${e}`)
+  }
+  if (httpRequest.status === 304 && etag && goNotModified(url)) {
+    console.log(`${url} is not modified... using the cached copy`)
+    return
+  }
   if (httpRequest.status === 200) {
     const body = httpRequest.responseText
     console.log(`got ${body.length} bytes from ${url}... saving to cache`)
-    goSaveToCache(url, body)
+    goSaveToCache(url, body, httpRequest.getResponseHeader('ETag'))
     return body
   }
-  console.log(`Unable to get code from ${url}`)
+  const reason = httpRequest.status ? `HTTP ${httpRequest.status} ${httpRequest.statusText}`.trim() : 'network error'
+  console.log(`Unable to get code from ${url}: ${reason}`)
+  goSaveToCache(url, null, reason) // Fall back to an expired cached copy, if any.
   return ""
 }
 
-const includeToUrl = (inc) => {
-  if (inc.startsWith('lygia/')) {
-    return `https://lygia.xyz/${inc.substring(6)}`
-  }
-  if (inc.startsWith('lygia.xyz/')) {
-    return `https://lygia.xyz/${inc.substring(10)}`
-  }
-  if (inc.startsWith('github.com/')) {
-    const noBlob = inc.substring(11).replace(/\/blob\//, '/')
-    return `https://raw.githubusercontent.com/${noBlob}`
+// resolveIncludes prefetches all live (nested) includes into the Go cache
+// so that the Go code can expand them without blocking on the network.
+// Go's preprocessor decides which includes are live (skipping those in
+// comments or inactive #if groups), and since included files may define
+// macros, this repeats until no new includes are discovered.
+// The optional language overrides the language of src.
+// It returns the number of files that were not already cached.
+// It is a function declaration (not a const) so that the Go code can
+// call it as a global.
+function resolveIncludes(src, language) {
+  if (!goPendingIncludesCallback) { console.log('pendingIncludes missing'); return 0 }
+  const attempted = {}
+  for (;;) {
+    const pending = goPendingIncludesCallback(src, language || null).filter((url) => !attempted[url])
+    if (pending.length === 0) { return Object.keys(attempted).length }
+    pending.forEach((url) => {
+      attempted[url] = true
+      getFile(url)
+    })
   }
-  return ''
-}
-
-const resolveIncludes = (lines) => {
-  if (!Array.isArray(lines)) { lines = lines.split(/\r?\n/) }
-
-  lines.forEach((line) => {
-    const trimmed = line.trim()
-    if (!trimmed.startsWith(`#include "`)) { return }
-    const m = trimmed.match(`#include "([^]*)"`)
-    if (!m) { return }
-    const inc = m[1].startsWith('lygia/') ? m[1].substring(6) :
-      m[1].startsWith('lygia.xyz/') ? m[1].substring(10) : ''
-    const url = includeToUrl(m[1])
-    if (!url) { return }
-    getFile(url)
-  })
 }
 
 let decorations = []
@@ -268,6 +367,7 @@ const compileShader = () => {
   let currentSelection = editor.getSelection()
   // Clear decorations.
   decorations = editor.deltaDecorations(decorations, [])
+  setDiagnostics([])
 
   const buf = editor.getValue()
   resolveIncludes(buf)
@@ -299,6 +399,22 @@ function highlightShaderError(line, column) {
   editor.revealLineInCenter(line)
 }
 
+// setDiagnostics marks each {line, message} of diagnostics as an error
+// in the editor (shown when hovering over the line) and highlights the first.
+function setDiagnostics(diagnostics) {
+  const model = editor.getModel()
+  const markers = diagnostics.map((d) => ({
+    severity: monaco.MarkerSeverity.Error,
+    startLineNumber: d.line,
+    startColumn: 1,
+    endLineNumber: d.line,
+    endColumn: model.getLineMaxColumn(Math.min(d.line, model.getLineCount())),
+    message: d.message
+  }))
+  monaco.editor.setModelMarkers(model, 'irmf', markers)
+  if (diagnostics.length > 0) { highlightShaderError(diagnostics[0].line) }
+}
+
 function getEditor() { return editor }
 
 require(["vs/editor/editor.main"], function () {
@@ -388,6 +504,152 @@ require(["vs/editor/editor.main"], function () {
 
   // Add Ctrl/Cmd-Enter to render updated model:
   editor.addCommand(monaco.KeyMod.CtrlCmd | monaco.KeyCode.Enter, compileShader)
+  editor.addAction({
+    id: 'irmf-convert-units',
+    label: 'IRMF: Convert units',
+    contextMenuGroupId: 'irmf',
+    run: function () {
+      if (!goConvertUnitsCallback) { console.log('convertUnitsCallback missing'); return }
+      const newUnits = prompt('Convert model to which units? (µm, mm, cm, m, in, ft)', currentUnits)
+      if (newUnits) { goConvertUnitsCallback(newUnits) }
+    }
+  })
+  editor.addAction({
+    id: 'irmf-export-compressed',
+    label: 'IRMF: Export compressed .irmf',
+    contextMenuGroupId: 'irmf',
+    run: function () {
+      if (!goExportShaderCallback) { console.log('exportShaderCallback missing'); return }
+      const encoding = prompt('Encoding for the shader body? (gzip or gzip+base64 for IRMF 1.0; the IRMF 1.1 draft also supports zlib, deflate, and base64, with "+base64" variants for text-safe output)', 'gzip+base64')
+      if (!encoding) { return }
+      const inlineIncludes = confirm('Inline all #include files first?')
+      if (inlineIncludes) { resolveIncludes(editor.getValue()) }
+      goExportShaderCallback(encoding, inlineIncludes)
+    }
+  })
+  editor.addAction({
+    id: 'irmf-open-file',
+    label: 'IRMF: Open file',
+    contextMenuGroupId: 'irmf',
+    run: function () {
+      const input = document.createElement('input')
+      input.type = 'file'
+      input.accept = '.irmf'
+      input.onchange = () => { if (input.files.length > 0) { openFile(input.files[0]) } }
+      input.click()
+    }
+  })
+  editor.addAction({
+    id: 'irmf-save-file',
+    label: 'IRMF: Save as .irmf',
+    contextMenuGroupId: 'irmf',
+    run: function () {
+      if (!goSaveFileCallback) { console.log('saveFileCallback missing'); return }
+      goSaveFileCallback()
+    }
+  })
+  // Open .irmf files dropped onto the editor.
+  const editorDiv = document.getElementById('one')
+  editorDiv.addEventListener('dragover', (e) => { e.preventDefault() }, true)
+  editorDiv.addEventListener('drop', (e) => {
+    if (e.dataTransfer.files.length === 0) { return }
+    e.preventDefault()
+    e.stopPropagation()
+    openFile(e.dataTransfer.files[0])
+  }, true)
+  editor.addAction({
+    id: 'irmf-share-link',
+    label: 'IRMF: Share link',
+    contextMenuGroupId: 'irmf',
+    run: function () {
+      if (!goShareLinkCallback) { console.log('shareLinkCallback missing'); return }
+      const result = goShareLinkCallback()
+      if (!result) { return }
+      history.replaceState(null, '', result.link)
+      if (navigator.clipboard) { navigator.clipboard.writeText(result.link).catch(() => { }) }
+      prompt((result.warning ? result.warning + '\n\n' : '') + 'Share link (copied to the clipboard):', result.link)
+    }
+  })
+  editor.addAction({
+    id: 'irmf-version-history',
+    label: 'IRMF: Version history',
+    contextMenuGroupId: 'irmf',
+    run: function () {
+      if (!goListHistoryCallback || !goDiffHistoryCallback || !goRestoreHistoryCallback) { console.log('history callbacks missing'); return }
+      const count = goListHistoryCallback()
+      if (!count) { return }
+      // Let the browser show the logged versions (and then the diff) before each dialog.
+      setTimeout(() => {
+        const n = parseInt(prompt(`Compare the editor with which version? (1-${count}, where 1 is the newest)`, '1'))
+        if (!n || !goDiffHistoryCallback(n)) { return }
+        setTimeout(() => {
+          if (confirm(`Restore version ${n}? The editor buffer is saved to the history first.`)) { goRestoreHistoryCallback(n) }
+        }, 100)
+      }, 100)
+    }
+  })
+  editor.addAction({
+    id: 'irmf-inline-includes',
+    label: 'IRMF: Inline all includes',
+    contextMenuGroupId: 'irmf',
+    run: function () {
+      if (!goInlineIncludesCallback) { console.log('inlineIncludesCallback missing'); return }
+      resolveIncludes(editor.getValue())
+      goInlineIncludesCallback()
+    }
+  })
+  editor.addAction({
+    id: 'irmf-update-include-lock',
+    label: 'IRMF: Update include lock',
+    contextMenuGroupId: 'irmf',
+    run: function () {
+      if (!goUpdateIncludeLockCallback) { console.log('updateIncludeLockCallback missing'); return }
+      resolveIncludes(editor.getValue())
+      goUpdateIncludeLockCallback()
+    }
+  })
+  editor.addAction({
+    id: 'irmf-list-include-cache',
+    label: 'IRMF: List include cache',
+    contextMenuGroupId: 'irmf',
+    run: function () {
+      if (!goListIncludeCacheCallback) { console.log('listIncludeCacheCallback missing'); return }
+      goListIncludeCacheCallback()
+    }
+  })
+  editor.addAction({
+    id: 'irmf-clear-include-cache',
+    label: 'IRMF: Clear include cache',
+    contextMenuGroupId: 'irmf',
+    run: function () {
+      if (!goClearIncludeCacheCallback) { console.log('clearIncludeCacheCallback missing'); return }
+      if (confirm('Remove all cached #include files?')) { goClearIncludeCacheCallback() }
+    }
+  })
+  editor.addAction({
+    id: 'irmf-trust-include-hosts',
+    label: 'IRMF: Trust include hosts',
+    contextMenuGroupId: 'irmf',
+    run: function () {
+      if (!goTrustedHostsCallback) { console.log('trustedHostsCallback missing'); return }
+      const hosts = prompt('Hosts to trust #include files from, besides lygia.xyz, raw.githubusercontent.com, and the host of the loaded file (space-separated, e.g. "gitlab.com *.example.com"):', goTrustedHostsCallback())
+      if (hosts === null) { return }
+      goTrustedHostsCallback(hosts)
+      compileShader()
+    }
+  })
+  editor.addAction({
+    id: 'irmf-prewarm-include-cache',
+    label: 'IRMF: Pre-warm include cache',
+    contextMenuGroupId: 'irmf',
+    run: function () {
+      const includes = prompt('Files to cache for offline use, with their own includes (space-separated, e.g. "lygia/math/const.glsl lygia/sdf/sphereSDF.glsl"):', '')
+      if (!includes) { return }
+      const src = includes.split(/[\s,]+/).filter((inc) => inc).map((inc) => `#include "${inc}"`).join('\n')
+      const n = resolveIncludes(src, currentLanguage)
+      jsLogf(`Pre-warmed the include cache with ${n} files`)
+    }
+  })
   // Also support Ctrl/Cmd-s just out of sheer habit, but don't advertize this
   // because it's not actually saving the shader anywhere... just compiling it.
   editor.addCommand(monaco.KeyMod.CtrlCmd | monaco.KeyCode.KEY_S, compileShader)
@@ -459,10 +721,15 @@ const hudCameraPerspective = new THREE.PerspectiveCamera(45, aspectRatio, 0.1, 1
 const hudCameraOrthographic = new THREE.OrthographicCamera(
   -hudFrustumSize, hudFrustumSize, hudFrustumSize, -hudFrustumSize, 0.1, 1000)
 
+// escapeHTML escapes the plain text s (such as a compiler log that names
+// untrusted include files) for use within innerHTML.
+function escapeHTML(s) {
+  return String(s).replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/"/g, '&quot;').replace(/'/g, '&#39;')
+}
 function jsLogf(s) {
   const logDiv = document.getElementById('logf')
   if (logDiv) {
-    logDiv.innerHTML += s + '<br>'
+    logDiv.innerHTML += escapeHTML(s) + '<br>'
     logDiv.scrollTop = logDiv.scrollHeight
   }
 }
@@ -533,6 +800,7 @@ class WebGPURenderer {
     })
   }
 
+  // loadNewModel compiles source and reports whether it succeeded.
   async loadNewModel(source) {
     try {
       jsLogf('WebGPU: Starting shader compilation...')
@@ -587,7 +855,7 @@ class WebGPURenderer {
           const logDiv = document.getElementById('logf')
           logDiv.innerHTML = '<div>WGSL COMPILATION EXCEPTION:</div><pre>WebGPU device lost or shader too complex (Instance dropped). Try reducing complexity or resolution.</pre>'
           console.error('WGSL COMPILATION EXCEPTION:', e)
-          return
+          return false
         }
         throw e
       }
@@ -598,22 +866,26 @@ class WebGPURenderer {
         let firstErrorLine = 0
         let firstErrorCol = 0
         for (const message of compilationInfo.messages) {
-          let line = message.lineNum - prefixLines + 1
-          log += `${message.type}: ${message.message} at line ${line}, col ${message.linePos}\n`
+          const loc = mapCompilerLine(message.lineNum - prefixLines + 1)
+          if (loc.include) {
+            log += `${message.type}: ${message.message} at ${loc.include}, col ${message.linePos} (included from line ${loc.editorLine})\n`
+          } else {
+            log += `${message.type}: ${message.message} at line ${loc.editorLine}, col ${message.linePos}\n`
+          }
           if (message.type === 'error') {
             hasError = true
             if (firstErrorLine === 0) {
-              firstErrorLine = line
-              firstErrorCol = message.linePos
+              firstErrorLine = loc.editorLine
+              firstErrorCol = loc.include ? 1 : message.linePos
             }
           }
         }
         if (hasError) {
           const logDiv = document.getElementById('logf')
-          logDiv.innerHTML = '<div>WGSL COMPILATION ERROR:</div><pre>' + log + '</pre>'
+          logDiv.innerHTML = '<div>WGSL COMPILATION ERROR:</div><pre>' + escapeHTML(log) + '</pre>'
           console.error('WGSL COMPILATION ERROR:', log)
           highlightShaderError(firstErrorLine, firstErrorCol)
-          return
+          return false
         } else {
           jsLogf('WGSL Compilation Warnings:\n' + log)
         }
@@ -660,7 +932,7 @@ class WebGPURenderer {
           if (activeRenderer instanceof WebGPURenderer) {
             activeRenderer = null
           }
-          return
+          return false
         }
         throw e
       }
@@ -674,10 +946,12 @@ class WebGPURenderer {
       this.bindGroup = bindGroup
       this.firstFrame = true
       jsLogf('WebGPU: Shader compiled and pipeline created successfully.')
+      return true
     } catch (e) {
       const logDiv = document.getElementById('logf')
-      logDiv.innerHTML = '<div>WGSL COMPILATION EXCEPTION:</div><pre>' + e.message + '</pre>'
+      logDiv.innerHTML = '<div>WGSL COMPILATION EXCEPTION:</div><pre>' + escapeHTML(e.message) + '</pre>'
       console.error('WGSL COMPILATION EXCEPTION:', e)
+      return false
     }
   }
 
@@ -870,8 +1144,9 @@ async function loadNewModel(source, language) {
     controls.domElement = canvas
   }
 
+  let compiled = true
   if (activeRenderer === webgpuRenderer) {
-    await webgpuRenderer.loadNewModel(source)
+    compiled = await webgpuRenderer.loadNewModel(source)
     jsLogf('WebGPU: Model loaded and rendered.')
   }
   uniformsChanged()
@@ -895,6 +1170,48 @@ async function loadNewModel(source, language) {
     viewCallbacks[6]()  // Reset to default view.
   }
   render()
+
+  // Only models that compile are saved to the version history.
+  if (activeRenderer !== webgpuRenderer) { compiled = !checkCompilerErrors() }
+  if (compiled && goCompileSucceededCallback) { goCompileSucceededCallback() }
+}
+
+// Scale bar and dimension readout:
+let currentUnits = 'mm'
+const scaleBarLine = document.getElementById('scale-bar-line')
+const scaleBarLabel = document.getElementById('scale-bar-label')
+const dimensionsDiv = document.getElementById('dimensions')
+function setUnits(units) {
+  currentUnits = units
+  updateScaleBar()
+}
+function niceLength(maxLength) {
+  // Return the largest 1, 2, or 5 times a power of ten that fits in maxLength.
+  const p = Math.pow(10, Math.floor(Math.log10(maxLength)))
+  if (5 * p <= maxLength) { return 5 * p }
+  if (2 * p <= maxLength) { return 2 * p }
+  return p
+}
+function updateScaleBar() {
+  if (!scaleBarLine || !activeCamera) { return }
+  const dx = rangeValues.maxx - rangeValues.minx
+  const dy = rangeValues.maxy - rangeValues.miny
+  const dz = rangeValues.maxz - rangeValues.minz
+  dimensionsDiv.innerText = `${+dx.toPrecision(6)} × ${+dy.toPrecision(6)} × ${+dz.toPrecision(6)} ${currentUnits}`
+
+  // Determine the number of model units per screen pixel at the look-at point.
+  let visibleHeight
+  if (activeCamera.isOrthographicCamera) {
+    visibleHeight = (activeCamera.top - activeCamera.bottom) / activeCamera.zoom
+  } else {
+    const d = activeCamera.position.distanceTo(controls.target)
+    visibleHeight = 2 * d * Math.tan(activeCamera.fov * Math.PI / 360)
+  }
+  const unitsPerPixel = visibleHeight / Math.max(1, canvas.height)
+  if (!(unitsPerPixel > 0)) { return }
+  const length = niceLength(100 * unitsPerPixel)  // Aim for at most 100 pixels.
+  scaleBarLine.style.width = Math.round(length / unitsPerPixel).toString() + 'px'
+  scaleBarLabel.innerText = `${+length.toPrecision(6)} ${currentUnits}`
 }
 
 function getLookAt() {
@@ -1365,7 +1682,10 @@ function animate() {
 }
 
 let errorRE = /ERROR: (\d+):(\d+):/
+// checkCompilerErrors reports the errors (if any) of compiling the current
+// GLSL model and returns whether there were any.
 function checkCompilerErrors() {
+  let hasErrors = false
   let currentCode = fsHeader + compilerSource
   for (let i = 0; i < renderer.info.programs.length; i++) {
     let program = renderer.info.programs[i]
@@ -1384,15 +1704,18 @@ function checkCompilerErrors() {
       if (match) {
         // highlight the error location.
         let column = match[1]
-        let line = match[2] - prefixLines - headerLines + 3
-        highlightShaderError(line, column)
-        log = 'ERROR: ' + (parseInt(column, 10) + 1).toString() + ':' + line.toString() + ':' + log.substr(match[0].length)
+        let loc = mapCompilerLine(match[2] - prefixLines - headerLines + 3)
+        highlightShaderError(loc.editorLine, column)
+        let where = loc.include ? loc.include + ' (included from line ' + loc.editorLine + ')' : loc.editorLine.toString()
+        log = 'ERROR: ' + (parseInt(column, 10) + 1).toString() + ':' + where + ':' + log.substr(match[0].length)
       }
       const logDiv = document.getElementById('logf')
-      logDiv.innerHTML = '<div>GLSL COMPILATION EXCEPTION:</div><pre>' + log + '</pre>'
+      logDiv.innerHTML = '<div>GLSL COMPILATION EXCEPTION:</div><pre>' + escapeHTML(log) + '</pre>'
       console.error('GLSL COMPILATION EXCEPTION:', log)
+      hasErrors = true
     }
   }
+  return hasErrors
 }
 function updateAxes() {
   if (mainAxesHelper) {
@@ -1445,4 +1768,5 @@ function render() {
   renderer.render(hudScene, hudActiveCamera)
   // console.log('restoring viewport to full canvas:', fullViewport);
   renderer.setViewport(fullViewport)
+  updateScaleBar()
 }
@@ -1,18 +1,21 @@
+//go:build js && wasm
+
 package main
 
 import (
-	"bytes"
-	"compress/gzip"
-	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
+	"html"
 	"math"
-	"net/http"
+	"net/url"
 	"regexp"
+	"slices"
 	"strings"
 	"syscall/js"
 	"time"
+	"unicode/utf8"
+
+	"github.com/gmlewis/irmf-editor/irmf"
 )
 
 var (
@@ -23,12 +26,11 @@ var (
 	setResolution js.Value
 )
 
-const (
-	githubRawPrefix = "https://raw.githubusercontent.com/"
-)
-
 func main() {
-	source := loadSource()
+	if mirrorURL := lygiaMirror(); mirrorURL != "" {
+		netFetcher = irmf.LygiaMirror(mirrorURL, netFetcher)
+	}
+	source, requested := loadSource()
 
 	// Wait until JS is initialized
 	f := func() {
@@ -56,6 +58,25 @@ func main() {
 	installCallback("installUpdateJSONOptionsCallback", updateJSONOptionsCallback)
 	installCallback("installAlreadyCached", alreadyCached)
 	installCallback("installSaveToCache", saveToCache)
+	installCallback("installConvertUnits", convertUnitsCallback)
+	installCallback("installExportShader", exportShaderCallback)
+	installCallback("installMapSourceLine", mapSourceLineCallback)
+	installCallback("installPendingIncludes", pendingIncludesCallback)
+	installCallback("installUpdateIncludeLock", updateIncludeLockCallback)
+	installCallback("installListIncludeCache", listIncludeCacheCallback)
+	installCallback("installInlineIncludes", inlineIncludesCallback)
+	installCallback("installClearIncludeCache", clearIncludeCacheCallback)
+	installCallback("installShareLink", shareLinkCallback)
+	installCallback("installListHistory", listHistoryCallback)
+	installCallback("installDiffHistory", diffHistoryCallback)
+	installCallback("installRestoreHistory", restoreHistoryCallback)
+	installCallback("installOpenFile", openFileCallback)
+	installCallback("installSaveFile", saveFileCallback)
+	installCallback("installReloadSource", reloadSourceCallback)
+	installCallback("installCompileSucceeded", compileSucceededCallback)
+	installCallback("installCachedETag", cachedETagCallback)
+	installCallback("installNotModified", notModifiedCallback)
+	installCallback("installTrustedHosts", trustedHostsCallback)
 
 	// // Install slice-button callback.
 	// cb2 := js.FuncOf(sliceShader)
@@ -67,9 +88,13 @@ func main() {
 
 	if len(source) > 0 {
 		initShader(source)
+	} else if latest, ok := history.Latest(); ok && !requested {
+		logf("Restoring %v", snapshotName(latest))
+		initShader([]byte(latest.Source))
 	} else {
 		initShader([]byte(startupShader))
 	}
+	autosave = true
 
 	logf("Application irmf-editor is now started")
 
@@ -101,9 +126,12 @@ func initShader(src []byte) interface{} {
 	if jsonBlob == nil {
 		return nil
 	}
+	for _, w := range jsonBlob.Warnings() {
+		logf("Warning: line %v: %v", w.Line, w)
+	}
 
 	// Rewrite the editor buffer:
-	newShader, err := jsonBlob.format(shaderSrc)
+	newShader, err := jsonBlob.Format(shaderSrc)
 	if err != nil {
 		logf("Error: %v", err)
 	} else {
@@ -123,7 +151,7 @@ func initShader(src []byte) interface{} {
 	colorPalette := js.Global().Call("getColorPalette")
 	if uniforms.Type() != js.TypeNull && uniforms.Type() != js.TypeUndefined &&
 		colorPalette.Type() != js.TypeNull && colorPalette.Type() != js.TypeUndefined {
-		setColor := func(n int, v *rgba) {
+		setColor := func(n int, v *irmf.RGBA) {
 			if v == nil {
 				return
 			}
@@ -174,7 +202,22 @@ func initShader(src []byte) interface{} {
 		rangeValues.Set("maxz", jsonBlob.Max[2])
 	}
 
-	newShader = processIncludes(newShader)
+	// Update the scale bar and dimension readout:
+	if setUnits := js.Global().Get("setUnits"); setUnits.Type() == js.TypeFunction {
+		setUnits.Invoke(jsonBlob.Units)
+	}
+
+	newShader, lastSourceMap, err = processIncludes(jsonBlob, newShader)
+	if err != nil {
+		logf("Unable to process includes:")
+		showDiagnostics(err)
+		return nil
+	}
+
+	pendingSnapshot = nil
+	if autosave {
+		pendingSnapshot = &irmf.Snapshot{Source: editor.Call("getValue").String(), Title: jsonBlob.Title}
+	}
 
 	// logf("Compiling new model shader:\n%v", newShader)
 	js.Global().Call("loadNewModel", newShader+fsFooter(jsonBlob), jsonBlob.Language)
@@ -345,105 +388,255 @@ func (m rgbMap) keys() (result []string) {
 	return result
 }
 
-func parseEditor(src []byte) (*irmf, string) {
-	if bytes.Index(src, []byte("/*{")) != 0 {
-		logf(`Unable to find leading "/*{"`) // TODO: Turn errors into hover-over text.
-		js.Global().Call("highlightShaderError", 1)
+func parseEditor(src []byte) (*irmf.IRMF, string) {
+	jsonBlob, shaderSrc, err := irmf.Parse(src)
+	if err != nil {
+		showDiagnostics(err)
 		return nil, ""
 	}
-	endJSON := bytes.Index(src, []byte("\n}*/\n"))
-	if endJSON < 0 {
-		logf(`Unable to find trailing "}*/"`)
-		// Try to find the end of the JSON blob.
-		if lineNum := findKeyLine(string(src), "*/"); lineNum > 2 {
-			js.Global().Call("highlightShaderError", lineNum)
-			return nil, ""
-		}
-		if lineNum := findKeyLine(string(src), "}*"); lineNum > 2 {
-			js.Global().Call("highlightShaderError", lineNum)
-			return nil, ""
-		}
-		if lineNum := findKeyLine(string(src), "}"); lineNum > 2 {
-			js.Global().Call("highlightShaderError", lineNum)
-			return nil, ""
+
+	return jsonBlob, shaderSrc
+}
+
+// showDiagnostics logs err and marks the editor lines it reports (if any)
+// with its messages as hover-over text.
+func showDiagnostics(err error) {
+	var lineErrs []*irmf.LineError
+	var includeErrs irmf.IncludeErrors
+	var lineErr *irmf.LineError
+	switch {
+	case errors.As(err, &includeErrs):
+		lineErrs = includeErrs
+	case errors.As(err, &lineErr):
+		lineErrs = []*irmf.LineError{lineErr}
+	default:
+		logf("%v", err)
+		return
+	}
+
+	var diagnostics []interface{}
+	for _, e := range lineErrs {
+		if e.Line == 0 {
+			logf("%v", e)
+			continue
 		}
-		js.Global().Call("highlightShaderError", 1)
-		return nil, ""
+		logf("Line %v: %v", e.Line, e)
+		diagnostics = append(diagnostics, map[string]interface{}{"line": e.Line, "message": e.Error()})
+	}
+	if setDiagnostics := js.Global().Get("setDiagnostics"); setDiagnostics.Type() == js.TypeFunction {
+		setDiagnostics.Invoke(diagnostics)
 	}
+}
+
+func updateJSONOptionsCallback(this js.Value, args []js.Value) interface{} {
+	src := editor.Call("getValue").String()
+	jsonBlob, shaderSrc := parseEditor([]byte(src))
+	updateJSONOptions(jsonBlob)
 
-	jsonBlobStr := string(src[2 : endJSON+2])
-	// logf(jsonBlobStr)
-	jsonBlob, err := parseJSON(jsonBlobStr)
+	// Rewrite the editor buffer:
+	newShader, err := jsonBlob.Format(shaderSrc)
 	if err != nil {
-		logf("Unable to parse JSON blob: %v", err)
-		js.Global().Call("highlightShaderError", 2)
-		return nil, ""
+		logf("Error: %v", err)
+	} else {
+		editor.Call("setValue", newShader)
 	}
+	return nil
+}
 
-	shaderSrcBuf := src[endJSON+5:]
-	var shaderSrc string
-	unzip := func(data []byte) error {
-		zr, err := gzip.NewReader(bytes.NewReader(data))
-		if err != nil {
-			return err
-		}
-		buf := &bytes.Buffer{}
-		if _, err := io.Copy(buf, zr); err != nil {
-			return err
-		}
-		if err := zr.Close(); err != nil {
-			return err
-		}
-		shaderSrc = buf.String()
+func convertUnitsCallback(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		logf("convertUnits: expected 1 arg, got %v", len(args))
 		return nil
 	}
 
-	if jsonBlob.Encoding != nil && *jsonBlob.Encoding == "gzip+base64" {
-		data, err := base64.RawStdEncoding.DecodeString(string(shaderSrcBuf))
-		if err != nil {
-			logf("uudecode error: %v", err)
-			return nil, ""
-		}
-		if err := unzip(data); err != nil {
-			logf("unzip: %v", err)
-			return nil, ""
-		}
-		jsonBlob.Encoding = nil
-	} else if jsonBlob.Encoding != nil && *jsonBlob.Encoding == "gzip" {
-		if err := unzip(shaderSrcBuf); err != nil {
-			logf("unzip: %v", err)
-			return nil, ""
+	newUnits := strings.TrimSpace(args[0].String())
+	src := editor.Call("getValue").String()
+	jsonBlob, shaderSrc := parseEditor([]byte(src))
+	if jsonBlob == nil {
+		return nil
+	}
+
+	oldUnits := jsonBlob.Units
+	shaderSrc, err := jsonBlob.ConvertUnits(shaderSrc, newUnits)
+	if err != nil {
+		logf("Unable to convert units: %v", err)
+		return nil
+	}
+	logf("Converted units from %v to %v", oldUnits, newUnits)
+
+	newShader, err := jsonBlob.Format(shaderSrc)
+	if err != nil {
+		logf("Error: %v", err)
+		return nil
+	}
+	return initShader([]byte(newShader))
+}
+
+// exportShaderCallback saves the editor buffer as an IRMF file whose shader
+// body is compressed with the requested encoding, optionally inlining
+// all "#include" lines first.
+func exportShaderCallback(this js.Value, args []js.Value) interface{} {
+	if len(args) != 2 {
+		logf("exportShader: expected 2 args, got %v", len(args))
+		return nil
+	}
+
+	encoding := args[0].String()
+	inlineIncludes := args[1].Bool()
+	src := editor.Call("getValue").String()
+	jsonBlob, shaderSrc := parseEditor([]byte(src))
+	if jsonBlob == nil {
+		return nil
+	}
+
+	if inlineIncludes {
+		var err error
+		if shaderSrc, err = jsonBlob.InlineIncludes(shaderSrc, sourceURL, includeFetcher, trustedSettings()); err != nil {
+			logf("%v", err)
+			return nil
 		}
-		jsonBlob.Encoding = nil
-	} else {
-		shaderSrc = string(shaderSrcBuf)
 	}
 
-	if lineNum, err := jsonBlob.validate(jsonBlobStr, shaderSrc); err != nil {
-		logf("Invalid JSON blob: %v", err)
-		js.Global().Call("highlightShaderError", lineNum)
-		return nil, ""
+	buf, err := jsonBlob.Encode(shaderSrc, encoding)
+	if err != nil {
+		logf("Unable to export shader: %v", err)
+		return nil
 	}
 
-	return jsonBlob, shaderSrc
+	filename := modelFilename(jsonBlob)
+	logf("Saving %v bytes to %v", len(buf), filename)
+	saveAs(buf, filename)
+	return nil
 }
 
-func updateJSONOptionsCallback(this js.Value, args []js.Value) interface{} {
+// updateIncludeLockCallback records the URL, version, and SHA-256 of every
+// included file in the "includes" section of the header, accepting their
+// current content. It requires an IRMF version that defines that key.
+func updateIncludeLockCallback(this js.Value, args []js.Value) interface{} {
 	src := editor.Call("getValue").String()
 	jsonBlob, shaderSrc := parseEditor([]byte(src))
-	updateJSONOptions(jsonBlob)
+	if jsonBlob == nil {
+		return nil
+	}
+	if !slices.Contains(irmf.VersionKeys(jsonBlob.IRMFVersion), "includes") {
+		logf("Unable to lock includes: IRMF %v has no \"includes\" key; migrate the file to IRMF 1.1 first (irmf-migrate -to 1.1)", jsonBlob.IRMFVersion)
+		return nil
+	}
 
-	// Rewrite the editor buffer:
-	newShader, err := jsonBlob.format(shaderSrc)
+	locks, err := irmf.LockIncludes(shaderSrc, includeOptions(jsonBlob), jsonBlob.IncludeFetcher(includeFetcher, sourceURL, trustedSettings()))
+	if err != nil {
+		logf("Unable to lock includes: %v", err)
+		return nil
+	}
+	jsonBlob.Includes = locks
+	logf("Locked %v included files", len(locks))
+
+	newShader, err := jsonBlob.Format(shaderSrc)
 	if err != nil {
 		logf("Error: %v", err)
-	} else {
-		editor.Call("setValue", newShader)
+		return nil
+	}
+	return initShader([]byte(newShader))
+}
+
+// inlineIncludesCallback saves a standalone copy of the editor buffer with
+// all of its includes inlined.
+func inlineIncludesCallback(this js.Value, args []js.Value) interface{} {
+	src := editor.Call("getValue").String()
+	jsonBlob, shaderSrc := parseEditor([]byte(src))
+	if jsonBlob == nil {
+		return nil
+	}
+
+	shaderSrc, err := jsonBlob.InlineIncludes(shaderSrc, sourceURL, includeFetcher, trustedSettings())
+	if err != nil {
+		logf("%v", err)
+		return nil
+	}
+	out, err := jsonBlob.Format(shaderSrc)
+	if err != nil {
+		logf("Error: %v", err)
+		return nil
+	}
+
+	filename := strings.TrimSuffix(modelFilename(jsonBlob), ".irmf") + "-inlined.irmf"
+	logf("Saving %v bytes to %v", len(out), filename)
+	saveAs([]byte(out), filename)
+	return nil
+}
+
+var unsafeFilenameRE = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// modelFilename returns a filename for saving the model based upon its title.
+func modelFilename(jsonBlob *irmf.IRMF) string {
+	name := strings.Trim(unsafeFilenameRE.ReplaceAllString(jsonBlob.Title, "-"), "-.")
+	if name == "" {
+		name = "model"
+	}
+	return name + ".irmf"
+}
+
+// openFileCallback replaces the editor buffer with the IRMF file whose
+// bytes (a Uint8Array) are args[0] and whose name is args[1]. Encoded
+// (e.g. gzip) shader bodies are decoded. It reports whether the file is
+// valid; if not, its problems are reported and (if it is text) it is still
+// loaded so that they can be fixed.
+func openFileCallback(this js.Value, args []js.Value) interface{} {
+	if len(args) != 2 {
+		logf("openFile: expected 2 args, got %v", len(args))
+		return false
 	}
+
+	buf := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(buf, args[0])
+	filename := args[1].String()
+	clearLog()
+	logf("Opening %v (%v bytes)", filename, len(buf))
+	sourceURL = "" // The relative includes of local files cannot be resolved.
+
+	jsonBlob, shaderSrc := parseEditor(buf)
+	if jsonBlob == nil {
+		if utf8.Valid(buf) {
+			editor.Call("setValue", string(buf))
+		}
+		return false
+	}
+	newShader, err := jsonBlob.Format(shaderSrc)
+	if err != nil {
+		logf("Error: %v", err)
+		return false
+	}
+	editor.Call("setValue", newShader)
+	return true
+}
+
+// saveFileCallback downloads the formatted editor buffer as a .irmf file.
+func saveFileCallback(this js.Value, args []js.Value) interface{} {
+	src := editor.Call("getValue").String()
+	jsonBlob, shaderSrc := parseEditor([]byte(src))
+	if jsonBlob == nil {
+		return nil
+	}
+
+	out, err := jsonBlob.Format(shaderSrc)
+	if err != nil {
+		logf("Error: %v", err)
+		return nil
+	}
+	filename := modelFilename(jsonBlob)
+	logf("Saving %v bytes to %v", len(out), filename)
+	saveAs([]byte(out), filename)
 	return nil
 }
 
-func updateJSONOptions(jsonBlob *irmf) {
+// saveAs downloads buf to the user's computer as filename.
+func saveAs(buf []byte, filename string) {
+	data := js.Global().Get("Uint8Array").New(len(buf))
+	js.CopyBytesToJS(data, buf)
+	js.Global().Call("saveAs", data, filename)
+}
+
+func updateJSONOptions(jsonBlob *irmf.IRMF) {
 	uniforms := js.Global().Call("getUniforms")
 	if uniforms.Type() != js.TypeNull && uniforms.Type() != js.TypeUndefined {
 		resolution := uniforms.Get("u_resolution").Get("value").Int()
@@ -451,7 +644,7 @@ func updateJSONOptions(jsonBlob *irmf) {
 
 		for i := range jsonBlob.Materials {
 			color := uniforms.Get(fmt.Sprintf("u_color%v", i+1)).Get("value")
-			v := &rgba{
+			v := &irmf.RGBA{
 				math.Floor(0.5 + 255.0*color.Get("x").Float()),
 				math.Floor(0.5 + 255.0*color.Get("y").Float()),
 				math.Floor(0.5 + 255.0*color.Get("z").Float()),
@@ -495,27 +688,88 @@ func updateJSONOptions(jsonBlob *irmf) {
 	}
 }
 
-func loadSource() []byte {
-	const oldPrefix = "/?s=github.com/"
-	url := js.Global().Get("document").Get("location").Get("href").String()
-	i := strings.Index(url, oldPrefix)
-	if i < 0 {
+// loadSource loads the IRMF file watched by "irmf-serve -watch" (see
+// loadWatched), contained in the fragment of the page's URL (see
+// irmf.ShareFragment), or else requested by its "s=" parameter (see
+// irmf.SourceURL), if any. It also reports whether a source was
+// requested at all.
+func loadSource() ([]byte, bool) {
+	href := js.Global().Get("document").Get("location").Get("href").String()
+	u, err := url.Parse(href)
+	if err != nil {
+		logf("Unable to parse page URL %v: %v", href, err)
+		return nil, false
+	}
+	if watch := u.Query().Get("watch"); watch != "" {
+		return loadWatched(u, watch), true
+	}
+	location := u.Query().Get("s")
+	shared := irmf.IsShareFragment(u.Fragment)
+	if location == "" && !shared {
 		logf("No source requested in URL path.")
-		return nil
+		return nil, false
+	}
+
+	var rawURL string
+	if location != "" {
+		if rawURL, err = irmf.SourceURL(location); err != nil {
+			loadSourceError(err)
+			return nil, true
+		}
 	}
-	location := url[i+len(oldPrefix):]
-	lower := strings.ToLower(location)
-	if !strings.HasSuffix(lower, ".irmf") {
-		js.Global().Call("alert", "irmf-editor will only load .irmf files")
+	if shared {
+		src, err := irmf.ParseShareFragment(u.Fragment)
+		if err != nil {
+			loadSourceError(err)
+			return nil, true
+		}
+		logf("Loaded %v bytes from the share link", len(src))
+		sourceURL = rawURL // Relative includes are still resolved against the shared file's origin.
+		return []byte(src), true
+	}
+
+	buf, err := curl(rawURL)
+	if err != nil {
+		loadSourceError(fmt.Errorf("unable to load %v: %v", rawURL, err))
+		return nil, true
+	}
+	sourceURL = rawURL
+	return buf, true
+}
+
+// loadSourceError reports why the requested source could not be loaded.
+func loadSourceError(err error) {
+	logf("%v", err)
+	js.Global().Call("alert", err.Error())
+}
+
+// shareLinkCallback returns a self-contained link to the current editor
+// buffer (see irmf.ShareFragment) along with any warning about its length.
+func shareLinkCallback(this js.Value, args []js.Value) interface{} {
+	src := editor.Call("getValue").String()
+	parseEditor([]byte(src)) // Report any problems, but share the buffer as-is.
+	fragment, err := irmf.ShareFragment(src)
+	if err != nil {
+		logf("Unable to make share link: %v", err)
 		return nil
 	}
 
-	location = githubRawPrefix + strings.Replace(location, "/blob/", "/", 1)
-	buf, _ := curl(location)
-	return buf
+	href := js.Global().Get("document").Get("location").Get("href").String()
+	if i := strings.Index(href, "#"); i >= 0 {
+		href = href[:i]
+	}
+	link := href + "#" + fragment
+	logf("Share link is %v characters long for %v bytes of source", len(link), len(src))
+	warning := irmf.ShareLinkWarning(link)
+	if warning != "" {
+		logf("%v", warning)
+	}
+	return map[string]interface{}{"link": link, "warning": warning}
 }
 
-var curlCache = map[string][]byte{}
+// sourceURL is the URL that the shader was loaded from (if any).
+// Relative "#include" lines in the shader are resolved against it.
+var sourceURL string
 
 func alreadyCached(this js.Value, args []js.Value) interface{} {
 	if len(args) != 1 {
@@ -524,103 +778,230 @@ func alreadyCached(this js.Value, args []js.Value) interface{} {
 	}
 
 	url := args[0].String()
-	_, ok := curlCache[url]
+	_, ok := cachedInclude(url, false)
 	return ok
 }
 
+// saveToCache caches the body (args[1]) fetched by JavaScript from url (args[0])
+// along with its optional ETag (args[2]). A null body means that the fetch
+// failed for the reason in args[2], in which case an expired cached copy is
+// used (if any) so that shaders keep working offline.
 func saveToCache(this js.Value, args []js.Value) interface{} {
-	if len(args) != 2 {
-		logf("saveToCache: expected 2 args, got %v", len(args))
+	if len(args) != 2 && len(args) != 3 {
+		logf("saveToCache: expected 2 or 3 args, got %v", len(args))
 		return nil
 	}
 
 	url := args[0].String()
-	body := []byte(args[1].String())
-	curlCache[url] = body
+	var arg2 string
+	if len(args) == 3 && args[2].Type() == js.TypeString {
+		arg2 = args[2].String()
+	}
+	if args[1].Type() == js.TypeNull {
+		if _, ok := cachedInclude(url, true); ok {
+			logf("Unable to download %v; using the expired cached copy", url)
+			return nil
+		}
+		if arg2 == "" {
+			arg2 = "download failed"
+		}
+		fetchFailures[url] = errors.New(arg2)
+		return nil
+	}
+	delete(fetchFailures, url)
+	storeInclude(url, []byte(args[1].String()), arg2)
 	return nil
 }
 
-func curl(url string) ([]byte, error) {
-	buf, ok := curlCache[url]
-	if ok {
-		return buf, nil
+// cachedETagCallback returns the ETag of the expired cached copy of url
+// (args[0]), if any, so that JavaScript can ask whether it is still current.
+func cachedETagCallback(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		logf("cachedETag: expected 1 arg, got %v", len(args))
+		return nil
 	}
+	return cachedETag(args[0].String())
+}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		logf("Unable to download source from: %v", url)
-		js.Global().Call("alert", "unable to load source from "+url)
-		return nil, nil
+// notModifiedCallback keeps using the expired cached copy of url (args[0])
+// after JavaScript found that it is still current.
+func notModifiedCallback(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		logf("notModified: expected 1 arg, got %v", len(args))
+		return nil
 	}
-	defer resp.Body.Close()
-	buf, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		logf("Unable to read response body.")
-		return nil, nil
+	_, ok := refreshInclude(args[0].String())
+	return ok
+}
+
+// fetchFailures records why JavaScript was unable to download each URL,
+// so that curl can report it without blocking on the network again.
+var fetchFailures = map[string]error{}
+
+var errNotCached = errors.New("not cached")
+
+// pendingIncludesCallback returns the URLs of all live (nested) includes
+// of the given IRMF source that are not yet in the cache. Since included
+// files may define macros that change which includes are live, JavaScript
+// calls this repeatedly, fetching the pending URLs, until none remain.
+// An optional second arg overrides the shader language.
+func pendingIncludesCallback(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 && len(args) != 2 {
+		logf("pendingIncludes: expected 1 or 2 args, got %v", len(args))
+		return nil
 	}
-	logf("Read %v bytes from %v", len(buf), url)
 
-	curlCache[url] = buf
-	return buf, nil
+	src := args[0].String()
+	opts := irmf.IncludeOptions{BaseURL: sourceURL, Language: irmf.DetectLanguage(src)}
+	jsonBlob := &irmf.IRMF{}
+	if j, shaderSrc, err := irmf.Parse([]byte(src)); err == nil {
+		src = shaderSrc // Decodes compressed shaders.
+		opts = includeOptions(j)
+		jsonBlob = j
+	}
+	if len(args) == 2 && args[1].Type() == js.TypeString {
+		opts.Language = args[1].String()
+	}
+
+	var pending []interface{}
+	seen := map[string]bool{}
+	// Only the URLs that may be fetched are recorded.
+	irmf.ExpandIncludes(src, opts, jsonBlob.IncludeFetcher(irmf.FetchFunc(func(url string) ([]byte, error) {
+		if buf, ok := cachedInclude(url, false); ok {
+			return buf, nil
+		}
+		if !seen[url] {
+			seen[url] = true
+			pending = append(pending, url)
+		}
+		return nil, errNotCached
+	}), sourceURL, trustedSettings()))
+	return pending
 }
 
-var (
-	includeRE = regexp.MustCompile(`^#include\s+"([^"]+)"`)
-)
+// trustedHostsKey is the settingsStore key of the hosts that the user
+// trusts includes to be fetched from (see irmf.IRMF.IncludeFetcher).
+const trustedHostsKey = "irmf-trusted-hosts"
 
-const (
-	lygiaBaseURL = "https://lygia.xyz"
-	prefix1      = "lygia.xyz/"
-	prefix2      = "lygia/"
-	prefix3      = "github.com/"
-)
+var settingsStore = browserStore()
 
-func parseIncludeURL(trimmed string) string {
-	m := includeRE.FindStringSubmatch(trimmed)
-	if len(m) < 2 {
-		return ""
+// trustedSettings returns the user's own include settings.
+func trustedSettings() *irmf.IncludeSettings {
+	s := &irmf.IncludeSettings{}
+	if v, ok := settingsStore.Get(trustedHostsKey); ok {
+		s.AllowedHosts = strings.Fields(v)
 	}
+	return s
+}
 
-	inc := m[1]
-	if !strings.HasSuffix(inc, ".glsl") {
-		return ""
+// trustedHostsCallback returns the hosts that the user trusts, separated
+// by spaces, or replaces them with its optional arg.
+func trustedHostsCallback(this js.Value, args []js.Value) interface{} {
+	if len(args) == 0 {
+		return strings.Join(trustedSettings().AllowedHosts, " ")
+	}
+	s := &irmf.IncludeSettings{AllowedHosts: strings.Fields(strings.ReplaceAll(args[0].String(), ",", " "))}
+	if err := s.Validate(); err != nil {
+		logf("Unable to trust hosts: %v", err)
+		return nil
 	}
+	if err := settingsStore.Set(trustedHostsKey, strings.Join(s.AllowedHosts, " ")); err != nil {
+		logf("Unable to trust hosts: %v", err)
+		return nil
+	}
+	logf("Includes may be fetched from %v", strings.Join(append(append([]string(nil), irmf.DefaultAllowedHosts...), s.AllowedHosts...), ", "))
+	return nil
+}
 
-	switch {
-	case strings.HasPrefix(inc, prefix1):
-		return fmt.Sprintf("%v/%v", lygiaBaseURL, inc[len(prefix1):])
-	case strings.HasPrefix(inc, prefix2):
-		return fmt.Sprintf("%v/%v", lygiaBaseURL, inc[len(prefix2):])
-	case strings.HasPrefix(inc, prefix3):
-		location := inc[len(prefix3):]
-		location = strings.Replace(location, "/blob/", "/", 1)
-		return githubRawPrefix + location
-	default:
+// includeFetcher resolves includes with the standard rules and fetches
+// them with curl.
+var includeFetcher irmf.Fetcher = irmf.FetchFunc(curl)
+
+// netFetcher downloads the includes that are not cached.
+var netFetcher irmf.Fetcher = irmf.HTTPFetcher{}
+
+// lygiaMirror returns the URL of the LYGIA mirror served by
+// "irmf-serve -lygia" (see the "lygia-mirror" meta tag), if any.
+func lygiaMirror() string {
+	meta := js.Global().Get("document").Call("querySelector", `meta[name="lygia-mirror"]`)
+	if meta.Type() != js.TypeObject {
 		return ""
 	}
+	return meta.Get("content").String()
 }
 
-// processIncludes converts "#include" lines (with recognized prefixes)
-// into their actual source by retrieving them from the internet.
-// Note that multiline comments ("/*" and "*/") are currently not supported.
-// It is recommended that an ignored "#include" statement should be commented-out
-// with single-line comments ("//...").
-func processIncludes(source string) string {
-	lines := strings.Split(source, "\n")
-	var result []string
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if url := parseIncludeURL(trimmed); url != "" {
-			if buf, err := curl(url); err == nil {
-				result = append(result, string(buf))
-			}
-			continue
+// curl returns the content of url from the cache, or else downloads it.
+func curl(url string) ([]byte, error) {
+	buf, ok := cachedInclude(url, false)
+	if ok {
+		return buf, nil
+	}
+	if err, ok := fetchFailures[url]; ok {
+		return nil, err
+	}
+
+	resp, err := irmf.FetchResponse(netFetcher, url, cachedETag(url))
+	if err != nil {
+		if buf, ok := cachedInclude(url, true); ok {
+			logf("Unable to download source from %v; using the expired cached copy", url)
+			return buf, nil
 		}
+		return nil, err
+	}
+	if resp.NotModified {
+		if buf, ok := refreshInclude(url); ok {
+			return buf, nil
+		}
+		// The cached copy vanished in the meantime; fetch it again.
+		if resp, err = irmf.FetchResponse(netFetcher, url, ""); err != nil {
+			return nil, err
+		}
+	}
+	logf("Read %v bytes from %v", len(resp.Body), url)
+
+	storeInclude(url, resp.Body, resp.ETag)
+	return resp.Body, nil
+}
+
+// processIncludes converts "#include" lines (with recognized prefixes)
+// into their actual source, recursively, using the curl cache which has
+// already been populated by the JavaScript "resolveIncludes". Includes
+// are resolved with the include settings of jsonBlob, and their content
+// is verified against its include lock. It also returns the map from
+// lines of the expanded source back to their original files.
+func processIncludes(jsonBlob *irmf.IRMF, source string) (string, irmf.SourceMap, error) {
+	return irmf.ExpandIncludesWithMap(source, includeOptions(jsonBlob), jsonBlob.VerifyingFetcher(jsonBlob.IncludeFetcher(includeFetcher, sourceURL, trustedSettings())))
+}
+
+// includeOptions returns the options for expanding the includes of jsonBlob's shader.
+func includeOptions(jsonBlob *irmf.IRMF) irmf.IncludeOptions {
+	return irmf.IncludeOptions{BaseURL: sourceURL, Language: jsonBlob.Language}
+}
+
+// lastSourceMap maps the lines of the most recently compiled model shader
+// (which starts with the editor buffer) back to the editor and included files.
+var lastSourceMap irmf.SourceMap
 
-		result = append(result, line)
+// mapSourceLineCallback translates a line number reported by the shader
+// compiler into {url, line, editorLine}, where url is "" for lines of the
+// editor buffer itself and editorLine is the line to highlight in the editor
+// (the "#include" line for included code). It returns null if the line
+// is not part of the model source (e.g. it falls within the footer).
+func mapSourceLineCallback(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		logf("mapSourceLine: expected 1 arg, got %v", len(args))
+		return nil
 	}
 
-	return strings.Join(result, "\n")
+	loc, ok := lastSourceMap.Lookup(args[0].Int())
+	if !ok {
+		return nil
+	}
+	return map[string]interface{}{
+		"url":        loc.URL,
+		"line":       loc.Line,
+		"editorLine": loc.RootLine,
+	}
 }
 
 func clearLog() {
@@ -629,16 +1010,33 @@ func clearLog() {
 	}
 }
 
+// logf logs a line of plain text. The text is always escaped, since it
+// often includes the names or contents of untrusted files.
 func logf(fmtStr string, args ...interface{}) {
+	appendLog("div", fmt.Sprintf(fmtStr, args...))
+}
+
+// logPre logs preformatted plain text, such as a diff.
+func logPre(text string) {
+	appendLog("pre", text)
+}
+
+func appendLog(tag, text string) {
 	if logfDiv.Type() != js.TypeNull && logfDiv.Type() != js.TypeUndefined {
 		txt := logfDiv.Get("innerHTML").String()
-		txt += fmt.Sprintf("<div>"+fmtStr+"</div>", args...)
+		txt += logHTML(tag, text)
 		logfDiv.Set("innerHTML", txt)
 	} else {
-		fmt.Printf(fmtStr+"\n", args...)
+		fmt.Println(text)
 	}
 }
 
+// logHTML returns the HTML of an element of the given tag containing
+// the (escaped) plain text.
+func logHTML(tag, text string) string {
+	return fmt.Sprintf("<%v>%v</%v>", tag, html.EscapeString(text), tag)
+}
+
 const startupShader = `/*{
   irmf: "1.0",
 	language: "glsl",
@@ -659,7 +1057,7 @@ void mainModel4(out vec4 materials, in vec3 xyz ) {
 }
 `
 
-func fsFooter(jsonBlob *irmf) string {
+func fsFooter(jsonBlob *irmf.IRMF) string {
 	if jsonBlob.Language == "wgsl" {
 		return wgslFooter(jsonBlob)
 	}
@@ -868,7 +1266,7 @@ void main() {
 }
 `
 
-func wgslFooter(jsonBlob *irmf) string {
+func wgslFooter(jsonBlob *irmf.IRMF) string {
 	numMaterials := len(jsonBlob.Materials)
 	var footerFmt string
 	var colorToMaterial func(colorNum int) string
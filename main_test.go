@@ -1,8 +1,15 @@
+//go:build js && wasm
+
 package main
 
 import (
+	"errors"
 	"reflect"
+	"strings"
+	"syscall/js"
 	"testing"
+
+	"github.com/gmlewis/irmf-editor/irmf"
 )
 
 func TestProcessMaterialNames(t *testing.T) {
@@ -137,47 +144,67 @@ func TestGenColorMixer(t *testing.T) {
 	}
 }
 
-func TestParseIncludeURL(t *testing.T) {
+func TestLogHTML(t *testing.T) {
 	tests := []struct {
-		name    string
-		trimmed string
-		want    string
+		name string
+		tag  string
+		text string
+		want string
 	}{
 		{
-			name: "empty",
+			name: "plain text",
+			tag:  "div",
+			text: "Loaded 3 files",
+			want: "<div>Loaded 3 files</div>",
 		},
 		{
-			name:    "bogus",
-			trimmed: `#include "bad/include.h"`,
+			name: "source URL with markup",
+			tag:  "div",
+			text: `unable to load "https://example.com/<script>alert(1)</script>.irmf": 404 Not Found`,
+			want: `<div>unable to load &#34;https://example.com/&lt;script&gt;alert(1)&lt;/script&gt;.irmf&#34;: 404 Not Found</div>`,
 		},
 		{
-			name:    "lygia normal",
-			trimmed: `#include "lygia/math/decimation.glsl"`,
-			want:    "https://lygia.xyz/math/decimation.glsl",
-		},
-		{
-			name:    "lygia extra space",
-			trimmed: `#include    "lygia/math/decimation.glsl"`,
-			want:    "https://lygia.xyz/math/decimation.glsl",
-		},
-		{
-			name:    "lygia accidental copy/paste",
-			trimmed: `#include "lygia.xyz/math/decimation.glsl"`,
-			want:    "https://lygia.xyz/math/decimation.glsl",
-		},
-		{
-			name:    "github normal",
-			trimmed: `#include "github.com/gmlewis/irmf-examples/blob/master/examples/012-bifilar-electromagnet/rotation.glsl"`,
-			want:    "https://raw.githubusercontent.com/gmlewis/irmf-examples/master/examples/012-bifilar-electromagnet/rotation.glsl",
+			name: "preformatted diff",
+			tag:  "pre",
+			text: "- a < b\n+ a > b & c",
+			want: "<pre>- a &lt; b\n+ a &gt; b &amp; c</pre>",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := parseIncludeURL(tt.trimmed)
-			if got != tt.want {
-				t.Errorf("parseIncludeURL got %v, want %v", got, tt.want)
+			if got := logHTML(tt.tag, tt.text); got != tt.want {
+				t.Errorf("logHTML = %q, want %q", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestShowDiagnosticsEscapesIncludePaths(t *testing.T) {
+	saved := logfDiv
+	defer func() { logfDiv = saved }()
+	logfDiv = js.Global().Get("Object").New()
+	logfDiv.Set("innerHTML", "")
+
+	// A fetcher that resolves include paths as-is, like a custom include host might.
+	src := "#include \"<img src=x onerror=alert(1)>.glsl\"\n"
+	opts := irmf.IncludeOptions{BaseURL: "https://example.com/model.irmf", Language: "glsl"}
+	_, err := irmf.ExpandIncludes(src, opts, rawFetcher{})
+	if err == nil {
+		t.Fatal("ExpandIncludes = nil, want an error for the missing include")
+	}
+	showDiagnostics(err)
+
+	got := logfDiv.Get("innerHTML").String()
+	if strings.Contains(got, "<img") {
+		t.Errorf("showDiagnostics logged unescaped markup: %v", got)
+	}
+	if !strings.Contains(got, "&lt;img src=x onerror=alert(1)&gt;.glsl") {
+		t.Errorf("showDiagnostics = %v, want the escaped include path", got)
+	}
+}
+
+type rawFetcher struct{}
+
+func (rawFetcher) Resolve(inc, parentURL, language string) string { return inc }
+func (rawFetcher) Fetch(url string) ([]byte, error)               { return nil, errors.New("not found") }
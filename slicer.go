@@ -1,3 +1,5 @@
+//go:build js && wasm
+
 package main
 
 import (
@@ -39,7 +41,7 @@ func sliceShader(this js.Value, args []js.Value) interface{} {
 	logf("Wrote %v bytes to ZIP file.", buf.Len())
 	img.Release()
 
-	js.Global().Call("saveAs", buf.Bytes(), "slices.zip")
+	saveAs(buf.Bytes(), "slices.zip")
 
 	return nil
 }
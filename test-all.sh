@@ -16,6 +16,9 @@ NEW_PATH="$WASM_EXEC_PATH"
 [ -d "$HOME/.bun/bin" ] && NEW_PATH="$NEW_PATH:$HOME/.bun/bin"
 export PATH="$NEW_PATH:/usr/bin:/bin"
 
+# Run native Go tests (the irmf package and command-line tools)
+go test ./...
+
 # Run Go WASM tests
 GOARCH=wasm GOOS=js go test
 
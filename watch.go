@@ -0,0 +1,59 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"syscall/js"
+)
+
+// localFilesURL is the URL of the directory served by "irmf-serve -watch",
+// if the editor is watching one of its files. Since these files change,
+// they are never persisted in the include cache.
+var localFilesURL string
+
+// isLocalFile reports whether url is a file of the watched directory.
+func isLocalFile(url string) bool {
+	return localFilesURL != "" && strings.HasPrefix(url, localFilesURL)
+}
+
+// loadWatched loads the file name of the directory served by
+// "irmf-serve -watch" (at the same host as page) and subscribes to its changes.
+func loadWatched(page *url.URL, name string) []byte {
+	localFilesURL = page.Scheme + "://" + page.Host + "/files/"
+	rawURL := localFilesURL + path.Clean("/" + name)[1:]
+	buf, err := curl(rawURL)
+	if err != nil {
+		loadSourceError(fmt.Errorf("unable to load %v (is irmf-serve running with -watch?): %v", rawURL, err))
+		return nil
+	}
+	sourceURL = rawURL
+	js.Global().Call("watchSource", "/events?file="+url.QueryEscape(name))
+	return buf
+}
+
+// reloadSourceCallback recompiles the watched file, whose new content is
+// args[0], after evicting the changed files (the URLs in args[1]) from the
+// include cache so that their new content is used.
+func reloadSourceCallback(this js.Value, args []js.Value) interface{} {
+	if len(args) != 2 {
+		logf("reloadSource: expected 2 args, got %v", len(args))
+		return nil
+	}
+
+	for i, n := 0, args[1].Length(); i < n; i++ {
+		evictInclude(args[1].Index(i).String())
+	}
+	src := args[0].String()
+	if resolveIncludes := js.Global().Get("resolveIncludes"); resolveIncludes.Type() == js.TypeFunction {
+		resolveIncludes.Invoke(src)
+	} else {
+		logf("reloadSource: resolveIncludes missing")
+	}
+	clearLog()
+	logf("Reloaded %v", sourceURL)
+	return initShader([]byte(src))
+}
@@ -0,0 +1,26 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"os"
+	"regexp"
+	"testing"
+)
+
+// TestWatchGlobals checks that the JavaScript functions called by the
+// watch code are declared with "function" in js/startup.js, since
+// top-level const and let bindings are not properties of the global
+// object and so cannot be found by js.Global().
+func TestWatchGlobals(t *testing.T) {
+	buf, err := os.ReadFile("js/startup.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"resolveIncludes", "watchSource"} {
+		re := regexp.MustCompile(`(?m)^(async )?function ` + name + `\(`)
+		if !re.Match(buf) {
+			t.Errorf("js/startup.js does not declare global function %v", name)
+		}
+	}
+}